@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveWindow は間隔を調整する際に参照する直近のレスポンスの件数
+const adaptiveWindow = 20
+
+// adaptiveDelay は日経のサイトからの 429 / 403 の割合に応じて、リクエストごとの待ち時間を調整する。
+// 制限されたレスポンスが返ると間隔を倍にし、直近のレスポンスに制限が無くなると少しずつ短くする。
+// 間隔は常に min 以上 max 以下に収める。
+type adaptiveDelay struct {
+	mu       sync.Mutex
+	min, max time.Duration
+	current  time.Duration
+	// 直近のレスポンスが制限されたものかどうか (リングバッファ)
+	recent [adaptiveWindow]bool
+	next   int
+}
+
+func newAdaptiveDelay(min, max time.Duration) *adaptiveDelay {
+	return &adaptiveDelay{min: min, max: max, current: min}
+}
+
+// interval は現在のリクエストごとの待ち時間を返す。
+func (a *adaptiveDelay) interval() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// observe はレスポンスのステータスコードを記録し、待ち時間を調整する。間隔を広げた場合は log に出力する。
+func (a *adaptiveDelay) observe(log Logger, statusCode int) {
+	throttled := statusCode == http.StatusTooManyRequests || statusCode == http.StatusForbidden
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recent[a.next] = throttled
+	a.next = (a.next + 1) % adaptiveWindow
+	throttledCount := 0
+	for _, t := range a.recent {
+		if t {
+			throttledCount++
+		}
+	}
+
+	previous := a.current
+	switch {
+	case throttled:
+		a.current *= 2
+		// min が 0 の場合も間隔を空けられるよう、最初は 1 秒から始める
+		if a.current < time.Second {
+			a.current = time.Second
+		}
+	case throttledCount == 0:
+		a.current = a.current * 4 / 5
+	default:
+		return
+	}
+	if a.current > a.max {
+		a.current = a.max
+	}
+	if a.current < a.min {
+		a.current = a.min
+	}
+	if throttled && a.current != previous {
+		log.Printf("日経のサイトからアクセスを制限するレスポンス (%d) が返ったため、リクエストの間隔を %s に広げます (直近 %d 件中 %d 件)", statusCode, a.current, adaptiveWindow, throttledCount)
+	}
+}
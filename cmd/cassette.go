@@ -0,0 +1,148 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	// CassetteRecord は実際にリクエストを送り、レスポンスを cassette に記録するモード
+	CassetteRecord = "record"
+	// CassetteReplay はリクエストを送らず、cassette に記録したレスポンスを返すモード
+	CassetteReplay = "replay"
+)
+
+// cassetteInteraction は cassette に記録した 1 回分のリクエストとレスポンス
+type cassetteInteraction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Cassette は日経のサイトへのリクエストとレスポンスを JSON のファイル (cassette) に記録し、再生する http.RoundTripper。
+// 記録したレスポンスを再生すると、実際のページと同じ内容に対する検索や株価の取得を、リクエストを送らずに毎回同じ結果で確認できる。
+// Scraper の Client と NoRedirectClient の Transport に設定して使う (--cassette)。
+type Cassette struct {
+	path string
+	mode string
+	// 記録する場合に実際にリクエストを送る RoundTripper
+	inner http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	// 再生で返した interaction
+	used []bool
+}
+
+// OpenCassette は path の cassette を mode (CassetteRecord または CassetteReplay) で開く。
+// CassetteRecord の場合は inner (nil の場合は http.DefaultTransport) でリクエストを送り、Save で path に書き出す。
+func OpenCassette(path, mode string, inner http.RoundTripper) (*Cassette, error) {
+	c := &Cassette{path: path, mode: mode, inner: inner}
+	switch mode {
+	case CassetteRecord:
+		if c.inner == nil {
+			c.inner = http.DefaultTransport
+		}
+	case CassetteReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cassette を読み込めませんでした: %w", err)
+		}
+		if err := json.Unmarshal(data, &c.interactions); err != nil {
+			return nil, fmt.Errorf("cassette の形式が不正です: %s: %w", path, err)
+		}
+		c.used = make([]bool, len(c.interactions))
+	default:
+		return nil, fmt.Errorf("--cassette-mode には %s または %s を指定してください: %s", CassetteRecord, CassetteReplay, mode)
+	}
+	return c, nil
+}
+
+// RoundTrip は CassetteRecord の場合はリクエストを送ってレスポンスを記録し、CassetteReplay の場合は記録したレスポンスを返す。
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.mode == CassetteReplay {
+		return c.replay(req)
+	}
+	resp, err := c.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, cassetteInteraction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+		Body:   string(body),
+	})
+	return resp, nil
+}
+
+// replay は req と同じメソッドと URL の interaction のうち、まだ返していない最初のものを返す。
+// すべて返し終えている場合は、リトライなどで同じページを取得し直したものとして最後のものを返す。
+func (c *Cassette) replay(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := -1
+	for i, interaction := range c.interactions {
+		if interaction.Method != req.Method || interaction.URL != req.URL.String() {
+			continue
+		}
+		found = i
+		if !c.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("cassette に記録されていないリクエストです: %s %s", req.Method, req.URL)
+	}
+	c.used[found] = true
+	interaction := c.interactions[found]
+	header := interaction.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(interaction.Body))),
+		ContentLength: int64(len(interaction.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Save は CassetteRecord の場合に記録したリクエストとレスポンスを cassette に書き出す。CassetteReplay の場合は何もしない。
+func (c *Cassette) Save() error {
+	if c.mode != CassetteRecord {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0o644)
+}
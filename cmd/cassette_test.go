@@ -0,0 +1,144 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCassetteScraper は testdata/cassettes の name を再生する Scraper を作る。
+// cassette は実際のページを記録したものではなく、日経のサイトのマークアップ (検索結果の候補のクラス名や
+// 年間高安の表の構成) をもとに、スクレイピングで使う要素だけを手で書いたもの。
+func newCassetteScraper(t *testing.T, name string) *Scraper {
+	t.Helper()
+	cassette, err := OpenCassette(filepath.Join("..", "testdata", "cassettes", name), CassetteReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScraper()
+	s.Logger = discardLogger{}
+	s.Client = &http.Client{Transport: cassette}
+	s.NoRedirectClient = &http.Client{
+		Transport: cassette,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+func TestCassetteFound(t *testing.T) {
+	s := newCassetteScraper(t, "found.json")
+
+	result, err := s.FetchPrices(context.Background(), "トヨタ自動車", "")
+	if err != nil {
+		t.Fatalf("FetchPrices() error = %v", err)
+	}
+	if result.StockCode != "7203" {
+		t.Errorf("StockCode = %q, want 7203", result.StockCode)
+	}
+	want := map[int]float64{2013: 6760, 2017: 7213, 2021: 2116, 2022: 1768}
+	for year, price := range want {
+		if result.Prices[year] != price {
+			t.Errorf("Prices[%d] = %v, want %v", year, result.Prices[year], price)
+		}
+	}
+	if len(result.Prices) != 10 {
+		t.Errorf("got %d prices, want 10: %v", len(result.Prices), result.Prices)
+	}
+}
+
+func TestCassetteAmbiguous(t *testing.T) {
+	t.Run("not interactive", func(t *testing.T) {
+		s := newCassetteScraper(t, "ambiguous.json")
+
+		// 企業名が一致する候補が無いため、候補があっても見つからなかったことになる
+		result, err := s.FetchPrices(context.Background(), "三菱", "")
+		if !errors.Is(err, ErrCompanyNotFound) {
+			t.Fatalf("FetchPrices() error = %v, want ErrCompanyNotFound", err)
+		}
+		if result.StockCode != "" {
+			t.Errorf("StockCode = %q, want empty", result.StockCode)
+		}
+	})
+	t.Run("interactive", func(t *testing.T) {
+		defer func(input *bufio.Reader) {
+			promptInput = input
+			delete(chosenCodes, "三菱")
+		}(promptInput)
+		// 2 番目の候補 (三菱電機) を選ぶ
+		promptInput = bufio.NewReader(strings.NewReader("2\n"))
+		s := newCassetteScraper(t, "ambiguous.json")
+		s.Interactive = true
+		s.NoHistory = true
+
+		result, err := s.FetchPrices(context.Background(), "三菱", "")
+		if err != nil {
+			t.Fatalf("FetchPrices() error = %v", err)
+		}
+		if result.StockCode != "6503" {
+			t.Errorf("StockCode = %q, want 6503", result.StockCode)
+		}
+	})
+}
+
+func TestCassetteNotFound(t *testing.T) {
+	s := newCassetteScraper(t, "not_found.json")
+
+	result, err := s.FetchPrices(context.Background(), "存在しない株式会社", "")
+	if !errors.Is(err, ErrCompanyNotFound) {
+		t.Fatalf("FetchPrices() error = %v, want ErrCompanyNotFound", err)
+	}
+	if result.CompanyName != "存在しない株式会社" || result.StockCode != "" {
+		t.Errorf("FetchPrices() = {CompanyName: %q, StockCode: %q}", result.CompanyName, result.StockCode)
+	}
+}
+
+func TestCassetteTooManyRequests(t *testing.T) {
+	s := newCassetteScraper(t, "too_many_requests.json")
+	s.Retries = 2
+	s.Backoff = BackoffPolicy{Base: time.Millisecond, Multiplier: 1, Max: time.Millisecond}
+
+	_, err := s.FetchPrices(context.Background(), "トヨタ自動車", "")
+	// cassette は記録した回数より多く取得すると最後のレスポンスを返すため、リトライしても 429 のまま
+	if got := s.totalRetries(); got != 2 {
+		t.Errorf("retried %d times, want 2", got)
+	}
+	if !errors.Is(err, ErrHTTPStatus) {
+		t.Fatalf("FetchPrices() error = %v, want ErrHTTPStatus", err)
+	}
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("FetchPrices() error = %v, want *HTTPStatusError with 429", err)
+	}
+	if errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("FetchPrices() error = %v, should not be ErrCompanyNotFound", err)
+	}
+}
+
+// Run は CLI のフラグを設定しなくても、Source の Scraper と Logger だけで動く
+func TestRunWithCassette(t *testing.T) {
+	l := &recordingLogger{}
+	results, rowErrs, err := Run(context.Background(), RunOptions{
+		Companies: []Company{{Name: "トヨタ自動車"}},
+		Source:    newCassetteScraper(t, "found.json"),
+		Logger:    l,
+	})
+	if err != nil || len(rowErrs) > 0 {
+		t.Fatalf("Run() error = %v, row errors = %v", err, rowErrs)
+	}
+	if len(results) != 1 || results[0].StockCode != "7203" || results[0].Index != 1 {
+		t.Fatalf("Run() = %+v, want トヨタ自動車 (7203) at index 1", results)
+	}
+	if len(l.lines) == 0 || l.lines[0] != "1: トヨタ自動車" {
+		t.Errorf("logged %q, want the company line in RunOptions.Logger", l.lines)
+	}
+}
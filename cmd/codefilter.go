@@ -0,0 +1,52 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"errors"
+	"strings"
+)
+
+// errCodeFiltered は --include-codes / --exclude-codes によって処理の対象外になったことを表す。
+var errCodeFiltered = errors.New("--include-codes / --exclude-codes により対象外のコードです")
+
+// codeSet はコードの集合
+type codeSet map[string]bool
+
+var (
+	// includeCodes が nil でない場合は、含まれるコードの企業のみ株価を取得する (--include-codes)
+	includeCodes codeSet
+	// excludeCodes に含まれるコードの企業は株価を取得しない (--exclude-codes)
+	excludeCodes codeSet
+)
+
+// parseCodeList はカンマ区切りのコードの一覧を解釈する。
+// 値が "@" で始まる場合は残りをファイルのパスとして読み込み、改行またはカンマ区切りのコードの一覧として扱う。
+// 値が空の場合は nil を返す。
+func parseCodeList(value string) (codeSet, error) {
+	if value == "" {
+		return nil, nil
+	}
+	value, err := readFlagValue(value)
+	if err != nil {
+		return nil, err
+	}
+	codes := codeSet{}
+	for _, code := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if code = normalizeStockCode(code); code != "" {
+			codes[code] = true
+		}
+	}
+	return codes, nil
+}
+
+// codeAllowed はコードの企業の株価を取得するかどうかを返す。
+func codeAllowed(code string) bool {
+	if includeCodes != nil && !includeCodes[code] {
+		return false
+	}
+	return !excludeCodes[code]
+}
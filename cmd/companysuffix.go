@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// companySuffixes は企業名の前後に付けられることがある会社の種類の表記
+var companySuffixes = []string{"株式会社", "(株)", "（株）", "㈱"}
+
+// trimCompanySuffix は企業名の前後に付いている会社の種類の表記 (株式会社など) を取り除く。
+func trimCompanySuffix(name string) string {
+	name = strings.TrimSpace(name)
+	for _, suffix := range companySuffixes {
+		name = strings.TrimSpace(strings.TrimPrefix(name, suffix))
+		name = strings.TrimSpace(strings.TrimSuffix(name, suffix))
+	}
+	return name
+}
+
+// companyNameVariants は --normalize-company-suffix で検索し直す企業名の候補を返す。
+// 株式会社を付けない・前に付ける・後ろに付けたものと、それぞれの英数字を半角にしたものを、
+// 元の企業名と重複しないように返す。
+func companyNameVariants(name string) []string {
+	base := trimCompanySuffix(name)
+	if base == "" {
+		return nil
+	}
+	var variants []string
+	seen := map[string]bool{strings.TrimSpace(name): true}
+	for _, candidate := range []string{base, "株式会社" + base, base + "株式会社"} {
+		for _, variant := range []string{candidate, width.Fold.String(candidate)} {
+			if seen[variant] {
+				continue
+			}
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
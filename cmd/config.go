@@ -0,0 +1,142 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var cfgFile string
+
+// configFlags は設定ファイルから値をセットしたフラグ (--print-config で値の出どころを表示するため)
+var configFlags = map[string]bool{}
+
+// configErr は initConfig で設定ファイルを読み込めなかった場合のエラー。
+// cobra.OnInitialize の関数はエラーを返せないため、PersistentPreRunE で返す。
+var configErr error
+
+// initConfig は設定ファイルを読み込む。フラグへの反映は実行するコマンドが決まってから checkConfig で行う。
+func initConfig() {
+	// --print-config では必須の引数が足りなくても設定を表示できるよう、必須の確認を行わない
+	if printConfigOnly, _ := rootCmd.Flags().GetBool("print-config"); printConfigOnly {
+		rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
+			delete(f.Annotations, cobra.BashCompOneRequiredFlag)
+		})
+	}
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		viper.AddConfigPath(home)
+		viper.SetConfigType("yaml")
+		viper.SetConfigName(".scrape-nikkei-past-price")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		// 設定ファイルを明示していない場合、ファイルが無いのは問題ない
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok && cfgFile == "" {
+			return
+		}
+		configErr = fmt.Errorf("設定ファイルの読み込みに失敗しました: %w", err)
+	}
+}
+
+// checkConfig は設定ファイルの読み込みに失敗していた場合にそのエラーを返し、読み込めた場合は実行するコマンドのフラグに値を反映する。
+// rootCmd の PersistentPreRunE として、必須のフラグの確認やコマンドの実行より前に呼び出すため、サブコマンドのフラグにも設定ファイルの値が使われる。
+// 優先順位は コマンドライン引数 > 設定ファイル > デフォルト値 となる。
+func checkConfig(cmd *cobra.Command, args []string) error {
+	if configErr != nil {
+		return configErr
+	}
+	return applyConfig(cmd.Flags())
+}
+
+// applyConfig はコマンドラインで指定されていないフラグに設定ファイルの値をセットする。
+// flags に無い項目 (他のコマンドのフラグなど) は無視する。
+func applyConfig(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !viper.IsSet(f.Name) {
+			return
+		}
+		// リストで指定された値は 1 つずつセットする (複数回指定できるフラグのため)
+		var values []string
+		switch v := viper.Get(f.Name).(type) {
+		case []interface{}:
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		for _, value := range values {
+			if e := flags.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("設定ファイルの %s の値が不正です: %w", f.Name, e)
+				return
+			}
+		}
+		configFlags[f.Name] = true
+	})
+	return err
+}
+
+// changedOnCommandLine はフラグがコマンドライン引数で指定されたかどうかを返す。
+// 必須のフラグを設定ファイルでも指定できるよう applyConfig は flags.Set で値をセットするため、
+// 設定ファイルの値も Changed になる。設定ファイルの値はデフォルト値として扱い、フラグの組み合わせの確認などには使わない。
+func changedOnCommandLine(flags *pflag.FlagSet, name string) bool {
+	return flags.Changed(name) && !configFlags[name]
+}
+
+// printConfigSkipFlags は --print-config で表示しないフラグ
+var printConfigSkipFlags = map[string]bool{"help": true, "version": true, "config": true, "print-config": true}
+
+// printConfig は設定ファイルとデフォルト値を反映した後のすべてのフラグの値を、設定ファイルにそのまま使える YAML として書き出す。
+// 値の出どころ (コマンドライン引数、設定ファイル、デフォルト値) はコメントで示す。
+func printConfig(w io.Writer, flags *pflag.FlagSet) {
+	if used := viper.ConfigFileUsed(); used != "" {
+		fmt.Fprintf(w, "# 設定ファイル: %s\n", used)
+	} else {
+		fmt.Fprintln(w, "# 設定ファイル: なし")
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		if printConfigSkipFlags[f.Name] {
+			return
+		}
+		source := "デフォルト値"
+		switch {
+		case configFlags[f.Name]:
+			source = "設定ファイル"
+		case f.Changed:
+			source = "コマンドライン引数"
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			values := slice.GetSlice()
+			if len(values) == 0 {
+				fmt.Fprintf(w, "%s: []  # %s\n", f.Name, source)
+				return
+			}
+			fmt.Fprintf(w, "%s:  # %s\n", f.Name, source)
+			for _, value := range values {
+				fmt.Fprintf(w, "  - %s\n", strconv.Quote(value))
+			}
+			return
+		}
+		value := f.Value.String()
+		switch f.Value.Type() {
+		case "string", "duration":
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s: %s  # %s\n", f.Name, value, source)
+	})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/width"
+)
+
+// currentPriceTimeLayouts は企業ページの現在値の日時の表記
+var currentPriceTimeLayouts = []string{"2006/1/2 15:04", "2006/1/2"}
+
+// currentPriceDateLayouts は年を含まない現在値の日時の表記。年は取得した日の年にする
+var currentPriceDateLayouts = []string{"1/2 15:04", "1/2"}
+
+// jst は日経のサイトに表示される日時のタイムゾーン
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+// parseCurrentPriceTime は現在値の日時の表記を RFC 3339 の文字列に変換する。
+// 解釈できない場合は表記をそのまま返す。
+func parseCurrentPriceTime(text string, fetchedAt time.Time) string {
+	text = strings.Join(strings.Fields(width.Narrow.String(text)), " ")
+	// "2022/9/1 15:00 現在" や "(15:00)" のような前後の文字は取り除く
+	text = strings.Trim(strings.TrimSuffix(text, "現在"), " ()")
+	for _, layout := range currentPriceTimeLayouts {
+		if t, err := time.ParseInLocation(layout, text, jst); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	for _, layout := range currentPriceDateLayouts {
+		if t, err := time.ParseInLocation(layout, text, jst); err == nil {
+			t = t.AddDate(fetchedAt.In(jst).Year(), 0, 0)
+			// 年明けに前年末の日時が表示されている場合は前年にする
+			if t.After(fetchedAt.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t.Format(time.RFC3339)
+		}
+	}
+	return text
+}
+
+// parseCurrentPrice は企業ページの現在値 (取引時間外は直近の終値) とその日時を取得する。
+// 現在値がページに無い場合は nil を返す。
+func parseCurrentPrice(doc *goquery.Document, fetchedAt time.Time) (*float64, string) {
+	price, ok, err := parsePrice(doc.Find(".m-stockPriceElm_value.now").First().Text())
+	if err != nil || !ok {
+		return nil, ""
+	}
+	asOf := ""
+	if text := strings.TrimSpace(doc.Find(".m-stockInfo_date").First().Text()); text != "" {
+		asOf = parseCurrentPriceTime(text, fetchedAt)
+	}
+	return &price, asOf
+}
+
+// getCurrentPrice は企業ページから取得時点の現在値とその日時を取得する (--with-current-price)。
+func (s *Scraper) getCurrentPrice(ctx context.Context, code string) (*float64, string, error) {
+	defer s.waitMinDelay(ctx)
+	companyURL := fmt.Sprintf("%s/nkd/company/?scode=%s", s.BaseURL, url.QueryEscape(code))
+	if err := s.checkRobots(companyURL); err != nil {
+		return nil, "", err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, companyURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, "", statusError(resp)
+	}
+	fetchedAt := time.Now()
+
+	doc, err := parseDocument(resp, code+"_company")
+	if err != nil {
+		return nil, "", err
+	}
+	if isBlockPage(doc) {
+		return nil, "", ErrBlocked
+	}
+	price, asOf := parseCurrentPrice(doc, fetchedAt)
+	if price == nil {
+		return nil, "", fmt.Errorf("企業ページに現在値が見つかりませんでした")
+	}
+	return price, asOf, nil
+}
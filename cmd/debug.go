@@ -0,0 +1,71 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// debugDumpDir は解析に失敗したセルの文字列を書き出すディレクトリ (--debug-dump)
+	debugDumpDir string
+	// debugDumpHTML は debugDumpDir に株価の表全体の HTML も書き出すかどうか (--debug-dump-html)
+	debugDumpHTML bool
+)
+
+// writeDebugDump は解析に失敗したセルの内容を debugDumpDir/<コード>.txt に書き出す。
+// tableHTML が空でない場合は <コード>.html に表全体の HTML も書き出す。
+func writeDebugDump(code string, problems []string, tableHTML string) error {
+	name := debugDumpName(code)
+	text := strings.Join(problems, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(debugDumpDir, name+".txt"), []byte(text), 0666); err != nil {
+		return fmt.Errorf("デバッグ用のファイルを書き出せませんでした: %w", err)
+	}
+	if tableHTML == "" {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(debugDumpDir, name+".html"), []byte(tableHTML), 0666); err != nil {
+		return fmt.Errorf("デバッグ用のファイルを書き出せませんでした: %w", err)
+	}
+	return nil
+}
+
+// debugDumpName は書き出すファイル名に使えるよう、パスの区切り文字を取り除く。
+func debugDumpName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// parseDocument は resp の本文を HTML として解析する。本文が途中で途切れたなどで読み込みや解析に失敗した場合は
+// ErrParse として扱い、--debug-dump が指定されていれば読み込めた分の本文を <name>.response.html に書き出す。
+func parseDocument(resp *http.Response, name string) (*goquery.Document, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		var doc *goquery.Document
+		doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err == nil {
+			return doc, nil
+		}
+	}
+	if debugDumpDir != "" {
+		path := filepath.Join(debugDumpDir, debugDumpName(name)+".response.html")
+		if dumpErr := os.WriteFile(path, body, 0666); dumpErr != nil {
+			logger.Printf("デバッグ用のファイルを書き出せませんでした: %v", dumpErr)
+		} else {
+			logger.Printf("解析できなかったページの本文 (%d バイト) を書き出しました: %s", len(body), path)
+		}
+	}
+	return nil, &ParseError{Kind: "ページの HTML ", Text: resp.Request.URL.String(), Err: err}
+}
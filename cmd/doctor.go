@@ -0,0 +1,122 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// doctorCheck は doctor サブコマンドで確認するページと、そのページに含まれているはずの要素
+type doctorCheck struct {
+	name     string
+	url      string
+	selector string
+	// 企業のページにリダイレクトされた場合に失敗にするかどうか (検索結果の一覧を確認する場合)
+	wantList bool
+}
+
+// runDoctorCheck は check のページを取得し、selector に一致する要素の数を返す。
+// ステータスコードが 200 でない場合や、ブロックされたページが返った場合はエラーを返す。
+func runDoctorCheck(ctx context.Context, s *Scraper, check doctorCheck) (int, error) {
+	if err := s.checkRobots(check.url); err != nil {
+		return 0, err
+	}
+	defer s.waitMinDelay(ctx)
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, check.url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, statusError(resp)
+	}
+	if check.wantList && resp.Request.URL.Query().Get("scode") != "" {
+		return 0, fmt.Errorf("検索結果の一覧ではなく企業のページ (%s) にリダイレクトされました (--keyword には複数の企業が該当する語を指定してください)", resp.Request.URL)
+	}
+	doc, err := parseDocument(resp, "doctor_"+check.name)
+	if err != nil {
+		return 0, err
+	}
+	if isBlockPage(doc) {
+		return 0, ErrBlocked
+	}
+	count := doc.Find(check.selector).Length()
+	if count == 0 {
+		return 0, fmt.Errorf("ページに %s が見つかりませんでした (日経のサイトのレイアウトが変わった可能性があります)", check.selector)
+	}
+	return count, nil
+}
+
+var doctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Aliases: []string{"healthcheck"},
+	Short:   "日経のサイトに接続でき、想定したページが返るかを確認します",
+	Long: `日経のサイトに接続でき、想定したページが返るかを確認します
+
+具体的な利用方法:
+  scrape-nikkei-past-price doctor
+
+検索結果のページと年間高安のページを 1 度ずつ取得し、スクレイピングで使う要素
+(.m-companyList_item_data_name と .m-headline) がページに含まれているかを確認します。
+大量の企業を処理する前に、日経のサイトの障害やレイアウトの変更に気付くために利用します。
+確認に失敗した場合は 0 以外の終了コードで終了します。`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keyword, err := cmd.Flags().GetString("keyword")
+		if err != nil {
+			return err
+		}
+		code, err := cmd.Flags().GetString("code")
+		if err != nil {
+			return err
+		}
+		code = normalizeStockCode(code)
+		if !stockCodePattern.MatchString(code) {
+			return fmt.Errorf("%w: %q", ErrInvalidStockCode, code)
+		}
+
+		checks := []doctorCheck{
+			{
+				name:     "検索",
+				url:      fmt.Sprintf("%s/nkd/search?searchKeyword=%s", defaultBaseURL, url.QueryEscape(keyword)),
+				selector: ".m-companyList_item_data_name",
+				wantList: true,
+			},
+			{
+				name:     "年間高安",
+				url:      fmt.Sprintf("%s/nkd/company/history/yprice?scode=%s", defaultBaseURL, url.QueryEscape(code)),
+				selector: ".m-headline",
+			},
+		}
+		out := cmd.OutOrStdout()
+		failed := 0
+		scraper := NewScraper()
+		for _, check := range checks {
+			count, err := runDoctorCheck(cmd.Context(), scraper, check)
+			if err != nil {
+				failed++
+				fmt.Fprintf(out, "NG  %s: %s\n    %v\n", check.name, check.url, err)
+				continue
+			}
+			fmt.Fprintf(out, "OK  %s: %s (%s: %d 件)\n", check.name, check.url, check.selector, count)
+		}
+		if failed > 0 {
+			return errors.New("日経のサイトの確認に失敗しました")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().String("keyword", "銀行", "検索結果のページの確認に使う検索語を指定してください (複数の企業が該当する語)")
+	doctorCmd.Flags().String("code", "7203", "年間高安のページの確認に使う企業のコードを指定してください")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// fieldColumnPrefix は --fields で指定された値の列を outputFields と区別するための列名の接頭辞
+const fieldColumnPrefix = "field:"
+
+// missingFieldWarned は表に見つからなかった見出しを 1 度だけログに出力するために使う
+var missingFieldWarned sync.Map
+
+// parseFields は --fields に指定されたカンマ区切りの見出しを解析する。
+func parseFields(value string) ([]string, error) {
+	var fields []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("--fields に空の見出しが含まれています: %q", value)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("--fields に同じ見出しが複数回指定されています: %s", name)
+		}
+		seen[name] = true
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// findFieldColumns は株価の表の見出しの行から、names の各見出しが何列目 (0 始まり) にあるかを求める。
+// 見出しは全角・半角や空白の違いを無視して部分一致で探し、見つからなかった見出しは結果に含めない。
+func findFieldColumns(table *goquery.Selection, names []string) map[string]int {
+	cols := map[string]int{}
+	table.Find("tr").EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		headers := row.Children()
+		texts := make([]string, headers.Length())
+		headers.Each(func(i int, cell *goquery.Selection) {
+			texts[i] = normalizeHeadline(cell.Text())
+		})
+		for _, name := range names {
+			want := normalizeHeadline(name)
+			for i, text := range texts {
+				if strings.Contains(text, want) {
+					cols[name] = i
+					break
+				}
+			}
+		}
+		// 見出しの行が見つかるまで次の行を探す
+		return len(cols) == 0
+	})
+	for _, name := range names {
+		if _, ok := cols[name]; !ok {
+			if _, warned := missingFieldWarned.LoadOrStore(name, true); !warned {
+				logger.Printf("株価の表に見出しが %q の列が見つかりませんでした (--fields)", name)
+			}
+		}
+	}
+	return cols
+}
+
+// parseFieldValue は --fields で指定された列の値を数値に変換する。出来高の列は出来高の表記として解釈する。
+func parseFieldValue(name, text string) (float64, bool, error) {
+	if strings.Contains(normalizeHeadline(name), "出来高") {
+		value, err := parseVolume(text)
+		return value, err == nil, err
+	}
+	return parsePrice(text)
+}
+
+// fieldOutput は --fields で指定された見出し name の値の列を作る。値が無い年は空欄にする。
+func fieldOutput(name string) outputField {
+	return yearlyField(name, func(o outputOptions, result ScrapeResult, year int) string {
+		value, ok := result.Fields[name][year]
+		if !ok {
+			return ""
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	})
+}
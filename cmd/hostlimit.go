@@ -0,0 +1,74 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// hostLimiter はリクエスト先のホストごとに同時に送るリクエストの数を制限する (--workers-per-host)。
+// 現在のリクエスト先は日経のサイトのみのため、実際には www.nikkei.com への同時リクエスト数の上限になる。
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int64
+	sems  map[string]*semaphore.Weighted
+}
+
+// concurrencyWarningRatio は --concurrency が --workers-per-host のこの倍数を超える場合に警告する。
+// 速さの上限ではなく、警告するかどうかの目安。
+const concurrencyWarningRatio = 2
+
+// concurrencyWarning は --concurrency が --workers-per-host を大きく超えている場合の警告を返す。
+// 日経のサイトへの同時リクエスト数は --workers-per-host で制限されるため、それを超えるワーカーはリクエストの枠を待つだけになる。
+// 少し超える程度は問題にならないため、concurrencyWarningRatio 倍を超える場合のみ警告し、不要な場合は空文字列を返す。
+// minDelay が指定されている場合は、そこから見積もった 1 秒あたりのリクエスト数の上限も含める。
+func concurrencyWarning(concurrency, workersPerHost int64, minDelay time.Duration) string {
+	if concurrency <= workersPerHost*concurrencyWarningRatio {
+		return ""
+	}
+	message := fmt.Sprintf("--concurrency (%d) が --workers-per-host (%d) を大きく超えています。日経のサイトへの同時リクエスト数は --workers-per-host の %d に制限されるため、--concurrency をそれより大きくしてもリクエストは増えず速くなりません", concurrency, workersPerHost, workersPerHost)
+	if rate := maxRequestRate(concurrency, workersPerHost, minDelay); rate > 0 {
+		message += fmt.Sprintf("（--min-delay (%s) のため、1 秒あたりのリクエスト数はおおよそ %.1f 件が上限です）", minDelay, rate)
+	}
+	return message
+}
+
+// maxRequestRate は --min-delay の待機から見積もった、日経のサイトへの 1 秒あたりのリクエスト数の上限を返す。
+// 各ワーカーはリクエストごとに minDelay 以上待つため、同時にリクエストを送れるワーカーの数 (--concurrency と --workers-per-host の小さい方) を
+// minDelay の秒数で割った数になる。応答を待つ時間や --adaptive-delay で広げた間隔は含めないため、実際にはこれより少なくなる。
+// minDelay が 0 の場合は待機による上限が無いため 0 を返す。
+func maxRequestRate(concurrency, workersPerHost int64, minDelay time.Duration) float64 {
+	if minDelay <= 0 {
+		return 0
+	}
+	workers := concurrency
+	if workersPerHost > 0 && workersPerHost < workers {
+		workers = workersPerHost
+	}
+	return float64(workers) / minDelay.Seconds()
+}
+
+func newHostLimiter(limit int64) *hostLimiter {
+	return &hostLimiter{limit: limit, sems: map[string]*semaphore.Weighted{}}
+}
+
+// acquire は host へのリクエストの枠を確保し、解放する関数を返す。
+func (h *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	h.mu.Lock()
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = semaphore.NewWeighted(h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { sem.Release(1) }, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// responseCache は取得したページのレスポンスを URL ごとにディレクトリへ保存し、
+// ttl 以内に同じ URL を取得する場合は日経のサイトへリクエストせずに保存したレスポンスを返す (--http-cache-dir)。
+type responseCache struct {
+	dir string
+	// 保存したレスポンスを使う期間。0 の場合は期限なし
+	ttl time.Duration
+}
+
+func newResponseCache(dir string, ttl time.Duration) (*responseCache, error) {
+	if ttl < 0 {
+		return nil, fmt.Errorf("--http-cache-ttl には 0 以上の値を指定してください: %s", ttl)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("--http-cache-dir のディレクトリを作成できませんでした: %w", err)
+	}
+	return &responseCache{dir: dir, ttl: ttl}, nil
+}
+
+// path は rawURL のレスポンスを保存するファイルのパスを返す。
+func (c *responseCache) path(client *http.Client, rawURL string) string {
+	key := rawURL
+	// リダイレクトを追わないクライアントでは、同じ URL でもリダイレクトのレスポンスそのものを返す
+	if client.CheckRedirect != nil {
+		key = "noredirect " + rawURL
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// get は保存されているレスポンスを返す。保存されていないか期限が切れている場合は false を返す。
+func (c *responseCache) get(ctx context.Context, client *http.Client, rawURL string) (*http.Response, bool) {
+	path := c.path(client, rawURL)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Printf("キャッシュを読み込めなかったため取得し直します: %s: %v", path, err)
+		return nil, false
+	}
+	// 1 行目はリダイレクトを追った後の URL で、その後にレスポンスをそのまま保存している
+	finalURL, raw, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		logger.Printf("キャッシュの形式が不正なため取得し直します: %s", path)
+		return nil, false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, string(finalURL), nil)
+	if err != nil {
+		logger.Printf("キャッシュの形式が不正なため取得し直します: %s: %v", path, err)
+		return nil, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err != nil {
+		logger.Printf("キャッシュの形式が不正なため取得し直します: %s: %v", path, err)
+		return nil, false
+	}
+	return resp, true
+}
+
+// put は resp を保存する。resp の本文は読み込み済みになるため、読み直せるものに置き換える。
+func (c *responseCache) put(client *http.Client, rawURL string, resp *http.Response) error {
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	path := c.path(client, rawURL)
+	// 途中まで書き込んだファイルを読み込まないよう、一時ファイルに書き込んでから置き換える
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(tmp, "%s\n%s", resp.Request.URL, dump)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// cacheableStatus はレスポンスを保存するステータスコードかどうかを返す。
+// エラーのレスポンスは次回に取得し直す。
+func cacheableStatus(statusCode int) bool {
+	return statusCode == http.StatusOK || (statusCode >= 300 && statusCode < 400)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+)
+
+// detectSampleSize は --stream-input の場合にエンコーディングの判定に使う先頭のバイト数
+const detectSampleSize = 64 * 1024
+
+// inputSource は 1 つの入力ファイルの内容の読み込み方を表す。
+// data が nil でない場合は読み込み済みの内容 (UTF-8) を使い、nil の場合は open のたびにファイルを
+// encoding から UTF-8 に変換しながら読み込む (--stream-input)。
+type inputSource struct {
+	path     string
+	encoding string
+	data     []byte
+}
+
+// loadInputSource は入力ファイル全体を読み込んで UTF-8 に変換した inputSource を返す。
+func loadInputSource(ctx context.Context, path, encoding string) (inputSource, error) {
+	data, err := openInputFile(ctx, path, encoding)
+	if err != nil {
+		return inputSource{}, err
+	}
+	return inputSource{path: path, data: data}, nil
+}
+
+// streamInputSource はファイル全体を読み込まずに、変換しながら読み込む inputSource を返す。
+// encoding が空の場合は、ファイルの先頭 detectSampleSize バイトからエンコーディングを判定する。
+func streamInputSource(path, encoding string) (inputSource, error) {
+	if encoding == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return inputSource{}, err
+		}
+		defer f.Close()
+		sample, err := io.ReadAll(io.LimitReader(f, detectSampleSize))
+		if err != nil {
+			return inputSource{}, err
+		}
+		encoding = detectEncoding(path, sample)
+	}
+	if e, _ := charset.Lookup(encoding); e == nil {
+		return inputSource{}, fmt.Errorf("入力ファイルのエンコーディングが不明です: %s", encoding)
+	}
+	return inputSource{path: path, encoding: encoding}, nil
+}
+
+// open は入力ファイルの内容を UTF-8 で先頭から読み込む io.ReadCloser を返す。先頭の BOM は取り除く。
+func (s inputSource) open() (io.ReadCloser, error) {
+	if s.data != nil {
+		return io.NopCloser(bytes.NewReader(s.data)), nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	e, _ := charset.Lookup(s.encoding)
+	if e == nil {
+		f.Close()
+		return nil, fmt.Errorf("入力ファイルのエンコーディングが不明です: %s", s.encoding)
+	}
+	r := bufio.NewReader(transform.NewReader(f, e.NewDecoder()))
+	if head, _ := r.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		r.Discard(len(utf8BOM))
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// readSource は src を開き、read で読み込んだ行の rowIterator を dispatch に渡す。
+func readSource(src inputSource, read inputReader, dispatch func(next rowIterator) error) error {
+	r, err := src.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return read(r, dispatch)
+}
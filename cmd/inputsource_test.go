@@ -0,0 +1,60 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestInputSourceTrimsBOM(t *testing.T) {
+	tests := []struct {
+		name, file, encoding string
+		stream               bool
+	}{
+		{name: "utf-8", file: "bom.csv", encoding: "utf-8"},
+		{name: "utf-8 detected", file: "bom.csv"},
+		{name: "utf-8 stream", file: "bom.csv", encoding: "utf-8", stream: true},
+		{name: "utf-16le", file: "bom_utf16le.csv", encoding: "utf-16le"},
+		{name: "utf-16le stream", file: "bom_utf16le.csv", encoding: "utf-16le", stream: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join("..", "testdata", "input", tt.file)
+			var (
+				src inputSource
+				err error
+			)
+			if tt.stream {
+				src, err = streamInputSource(path, tt.encoding)
+			} else {
+				src, err = loadInputSource(context.Background(), path, tt.encoding)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// ヘッダも引用符で囲まれているため、BOM が残っていると csv として読み込めない
+			var header []inputRow
+			err = readSource(src, func(r io.Reader, dispatch func(next rowIterator) error) error {
+				return readCsvTo(discardLogger{}, r, ',', 0, 0, 1, dispatch)
+			}, func(next rowIterator) error {
+				for {
+					row, ok, err := next()
+					if err != nil || !ok {
+						return err
+					}
+					header = append(header, row)
+				}
+			})
+			if err != nil {
+				t.Fatalf("readSource() error = %v", err)
+			}
+			if len(header) != 3 || header[0].companyName != "企業名" || header[1].companyName != "トヨタ自動車" || header[2].fallback != "6758" {
+				t.Errorf("rows = %+v, want the header and 2 companies without a BOM", header)
+			}
+		})
+	}
+}
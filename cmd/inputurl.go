@@ -0,0 +1,42 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// isInputURL は --input に http(s) の URL が指定されているかどうかを返す。
+func isInputURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchInputURL は URL の入力ファイルを HTTP で取得する。
+// 日経のサイトへのリクエストではないため、--http-cache-dir や robots.txt の確認、リトライは行わない。
+// 取得にかける時間は呼び出し元が ctx で制限する。
+func fetchInputURL(ctx context.Context, rawURL string) ([]byte, error) {
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルの URL が不正です: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルを取得できませんでした: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("入力ファイルを取得できませんでした: %s: ステータスコード %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("入力ファイルを取得できませんでした: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/saintfish/chardet"
+	"github.com/spf13/cobra"
+)
+
+// inputBOMs は入力ファイルの先頭に付いていることがある BOM とその種類
+var inputBOMs = []struct {
+	name string
+	bom  []byte
+}{
+	{"UTF-8", []byte{0xef, 0xbb, 0xbf}},
+	{"UTF-16LE", []byte{0xff, 0xfe}},
+	{"UTF-16BE", []byte{0xfe, 0xff}},
+}
+
+// detectBOM は src の先頭に付いている BOM の種類を返す。BOM が無い場合は空文字を返す。
+func detectBOM(src []byte) string {
+	for _, b := range inputBOMs {
+		if bytes.HasPrefix(src, b.bom) {
+			return b.name
+		}
+	}
+	return ""
+}
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file>",
+	Short: "入力ファイルのエンコーディングの判定結果と、変換した先頭の数行を表示します",
+	Long: `入力ファイルのエンコーディングの判定結果と、変換した先頭の数行を表示します
+
+具体的な利用方法:
+  scrape-nikkei-past-price inspect 企業一覧.csv
+
+文字化けする場合に、スクレイピングを始める前にどのエンコーディングとして読み込まれるかを確認するために利用します。
+判定結果が誤っている場合は --input-encoding でエンコーディングを指定してください。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		lines, err := cmd.Flags().GetInt("lines")
+		if err != nil {
+			return err
+		}
+		if lines < 0 {
+			return fmt.Errorf("--lines には 0 以上の値を指定してください: %d", lines)
+		}
+
+		src, err := readInputFile(cmd.Context(), path)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		if r, err := chardet.NewTextDetector().DetectBest(src); err != nil {
+			fmt.Fprintf(out, "判定結果: 判定できませんでした (%v)\n", err)
+		} else {
+			fmt.Fprintf(out, "判定結果: %s (確信度: %d%%", r.Charset, r.Confidence)
+			if r.Language != "" {
+				fmt.Fprintf(out, ", 言語: %s", r.Language)
+			}
+			fmt.Fprintln(out, ")")
+		}
+		// 実際の処理と同じく、判定できなかった場合や対応していない場合は UTF-8 として読み込む
+		encoding := detectEncoding(path, src)
+		fmt.Fprintf(out, "読み込むエンコーディング: %s\n", encoding)
+		if bom := detectBOM(src); bom != "" {
+			fmt.Fprintf(out, "BOM: あり (%s)\n", bom)
+		} else {
+			fmt.Fprintln(out, "BOM: なし")
+		}
+
+		decoded, err := openInputFile(cmd.Context(), path, encoding)
+		if err != nil {
+			return err
+		}
+		if lines == 0 {
+			return nil
+		}
+		fmt.Fprintf(out, "先頭の %d 行:\n", lines)
+		for i, line := range strings.SplitN(strings.TrimSuffix(string(decoded), "\n"), "\n", lines+1) {
+			if i >= lines {
+				break
+			}
+			fmt.Fprintf(out, "  %d: %s\n", i+1, strings.TrimRight(line, "\r"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().Int("lines", 5, "変換した内容を表示する先頭の行数を指定してください")
+}
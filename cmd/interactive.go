@@ -0,0 +1,72 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// companyCandidate は日経のサイトの検索結果に表示された企業の候補
+type companyCandidate struct {
+	Name, Code string
+}
+
+var (
+	// interactive は --interactive が指定されているかどうか
+	interactive bool
+
+	// promptMu は複数のワーカーが同時に端末に質問しないようにする
+	promptMu sync.Mutex
+	// promptInput は質問への回答を読み込む入力
+	promptInput = bufio.NewReader(os.Stdin)
+	// chosenCodes は企業名ごとに選ばれたコード。選ばなかった場合は空文字を記録し、同じ企業名では再度質問しない
+	chosenCodes = map[string]string{}
+)
+
+// rememberedChoice は以前に同じ企業名で選ばれたコードを返す。
+func rememberedChoice(companyName string) (code string, ok bool) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	code, ok = chosenCodes[companyName]
+	return code, ok
+}
+
+// chooseCandidate は検索結果の候補を端末に表示し、どの企業かを選んでもらう。
+// 選んだコードを返し、該当する企業が無い場合は空文字を返す。選んだ結果は実行中は記憶しておく。
+func chooseCandidate(companyName string, candidates []companyCandidate) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if code, ok := chosenCodes[companyName]; ok {
+		return code, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%q の候補が複数あります:\n", companyName)
+	for i, c := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s (%s)\n", i+1, c.Name, c.Code)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "番号を入力してください (該当なしは 0): ")
+		line, err := promptInput.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("候補の選択を読み込めませんでした: %w", err)
+		}
+		n, convErr := strconv.Atoi(strings.TrimSpace(line))
+		if convErr != nil || n < 0 || n > len(candidates) {
+			fmt.Fprintf(os.Stderr, "0 から %d の番号を入力してください\n", len(candidates))
+			continue
+		}
+		code := ""
+		if n > 0 {
+			code = candidates[n-1].Code
+		}
+		chosenCodes[companyName] = code
+		return code, nil
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// 入力ファイルを csv として読み込む
+	inputFormatCSV = "csv"
+	// 入力ファイルを {name, code} の JSON の配列として読み込む
+	inputFormatJSON = "json"
+)
+
+// jsonInputRow は --input-format json の入力ファイルの 1 要素
+type jsonInputRow struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
+// readJSON は [{"name": "...", "code": "..."}, ...] の形式の JSON の各要素を返す rowIterator を dispatch に渡す。
+// 各行の number は配列での 1 始まりの位置で、code は企業名で見つからなかった場合の検索に使う。
+// 企業名の整形などの警告は log に出力する。
+func readJSON(log Logger, src io.Reader, dispatch func(next rowIterator) error) error {
+	var records []jsonInputRow
+	if err := json.NewDecoder(src).Decode(&records); err != nil {
+		return fmt.Errorf("入力ファイルを JSON の配列として読み込めませんでした: %w", err)
+	}
+
+	rows := make([]inputRow, 0, len(records))
+	for i, record := range records {
+		companyName := sanitizeCompanyName(record.Name)
+		if companyName != record.Name {
+			log.Printf("%d: 企業名を %q から %q に整形しました", i+1, record.Name, companyName)
+		}
+		fallback := sanitizeCompanyName(record.Code)
+		if companyName == "" && fallback == "" {
+			log.Printf("%d: 企業名が空のため読み飛ばします", i+1)
+			continue
+		}
+		rows = append(rows, inputRow{number: i + 1, companyName: companyName, fallback: fallback})
+	}
+	return dispatch(sliceRows(rows))
+}
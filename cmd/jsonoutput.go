@@ -0,0 +1,78 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter はスクレイピング結果を 1 つの JSON の配列として書き込む。
+// 配列全体をメモリに持たないよう、要素は 1 件ずつ書き出し、Close で配列を閉じる。
+type jsonWriter struct {
+	f      io.WriteCloser
+	buf    *bufio.Writer
+	pretty bool
+	// これまでに書き込んだ要素の数
+	count int
+}
+
+func newJSONWriter(path string, gzipOutput, pretty bool) (*jsonWriter, error) {
+	f, _, err := createOutputWriter(path, false, gzipOutput)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonWriter{f: f, buf: bufio.NewWriter(f), pretty: pretty}, nil
+}
+
+// WriteHeader は配列の始まりを書き込む。
+func (j *jsonWriter) WriteHeader() error {
+	_, err := j.buf.WriteString("[")
+	return err
+}
+
+// WriteResult は 1 企業分の結果を配列の要素として書き込む。要素の形式は --format ndjson の 1 行と同じ。
+func (j *jsonWriter) WriteResult(result ScrapeResult) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if j.pretty {
+		enc.SetIndent("  ", "  ")
+	}
+	if err := enc.Encode(ndjsonRecord{Index: result.Index, ScrapeResult: result}); err != nil {
+		return err
+	}
+	if j.count > 0 {
+		j.buf.WriteString(",")
+	}
+	if j.pretty {
+		j.buf.WriteString("\n  ")
+	}
+	j.count++
+	// Encode が末尾に付ける改行は取り除く
+	_, err := j.buf.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return err
+}
+
+func (j *jsonWriter) flush() error {
+	if err := j.buf.Flush(); err != nil {
+		return err
+	}
+	return flushOutput(j.f)
+}
+
+// Close は配列を閉じてファイルを閉じる。
+func (j *jsonWriter) Close() error {
+	if j.pretty && j.count > 0 {
+		j.buf.WriteString("\n")
+	}
+	j.buf.WriteString("]\n")
+	if err := j.buf.Flush(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
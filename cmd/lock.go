@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errLocked は他のプロセスがロックファイルをロックしていることを表す。
+var errLocked = errors.New("ロックファイルは他のプロセスがロックしています")
+
+// lockPollInterval は --lock-wait でロックが解放されるのを待つ間隔
+const lockPollInterval = time.Second
+
+// acquireLock は path のロックファイルを排他的にロックし、解放する関数を返す。
+// 他のプロセスがロックしている場合は wait の間だけ解放を待ち、それでもロックできなければエラーを返す。
+// プロセスが終了した場合はロックは OS によって解放されるため、異常終了してもロックが残ることはない。
+func acquireLock(ctx context.Context, path string, wait time.Duration) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("ロックファイルを開けません: %w", err)
+	}
+	deadline := time.Now().Add(wait)
+	logged := false
+	for {
+		err = tryLockFile(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLocked) || !time.Now().Before(deadline) {
+			f.Close()
+			if errors.Is(err, errLocked) {
+				return nil, fmt.Errorf("他の実行が終わっていないため終了します (%s): %w", path, err)
+			}
+			return nil, fmt.Errorf("ロックファイルをロックできません: %w", err)
+		}
+		if !logged {
+			logger.Printf("他の実行が終わるのを最大 %s 待ちます (%s)", wait, path)
+			logged = true
+		}
+		if !sleepContext(ctx, lockPollInterval) {
+			f.Close()
+			return nil, ctx.Err()
+		}
+	}
+	// どのプロセスがロックしているか分かるよう PID を書いておく
+	if err := f.Truncate(0); err == nil {
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
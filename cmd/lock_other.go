@@ -0,0 +1,20 @@
+//go:build !unix
+
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile は flock が無い環境では利用できない。
+func tryLockFile(f *os.File) error {
+	return errors.New("--lockfile はこの OS では利用できません")
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
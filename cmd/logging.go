@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger は処理中のログの出力先。*log.Logger はこのインターフェイスを満たす。
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logger は処理中のログの出力先。CLI では標準の log パッケージのロガーを使う。
+var logger Logger = log.Default()
+
+// SetLogger はログの出力先を l に変更する。nil の場合は標準の log パッケージのロガーに戻す。
+// 他のプログラムに組み込んで使う場合やテストでログを確認する場合に使う。
+func SetLogger(l Logger) {
+	if l == nil {
+		l = log.Default()
+	}
+	logger = l
+}
+
+// discardLogger は何も出力しない Logger。
+// 行数を数えるためだけに入力ファイルを読み込む場合など、同じ警告を繰り返し出力しないために使う。
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+// logFields は構造化ログに付与する項目
+type logFields struct {
+	Company string
+	// 入力ファイルでの行番号。特定の行の処理ではないログ (リトライなど) では nil
+	Index    *int
+	URL      string
+	Duration time.Duration
+}
+
+// fieldLogger は企業名などの項目を付けたログを出力できる Logger。
+// logWithFields は logger がこのインターフェイスを満たす場合に項目を付けて出力する。
+type fieldLogger interface {
+	Logger
+	logFields(level string, fields logFields, message string)
+}
+
+// logRecord は --log-format json で出力する 1 行分のログ
+type logRecord struct {
+	Time       string  `json:"time"`
+	Level      string  `json:"level"`
+	Message    string  `json:"message"`
+	Company    string  `json:"company,omitempty"`
+	Index      *int    `json:"index,omitempty"`
+	URL        string  `json:"url,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+}
+
+// jsonLogger は --log-format json の場合のロガー。ログを 1 行ずつ JSON で出力する。
+// 標準の log パッケージの出力先にも使い、Printf や log の出力は info のログとして出力する。
+type jsonLogger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (l *jsonLogger) Printf(format string, v ...interface{}) {
+	l.writeRecord(logRecord{Level: "info", Message: fmt.Sprintf(format, v...)})
+}
+
+func (l *jsonLogger) Write(p []byte) (int, error) {
+	l.writeRecord(logRecord{Level: "info", Message: strings.TrimRight(string(p), "\n")})
+	return len(p), nil
+}
+
+func (l *jsonLogger) logFields(level string, fields logFields, message string) {
+	l.writeRecord(logRecord{
+		Level:      level,
+		Message:    message,
+		Company:    fields.Company,
+		Index:      fields.Index,
+		URL:        fields.URL,
+		DurationMs: float64(fields.Duration) / float64(time.Millisecond),
+	})
+}
+
+func (l *jsonLogger) writeRecord(record logRecord) {
+	record.Time = time.Now().Format(time.RFC3339Nano)
+	b, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(b, '\n'))
+}
+
+// setLogFormat はログの出力形式を設定する。format は text または json。
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(os.Stderr)
+		SetLogger(nil)
+	case "json":
+		l := &jsonLogger{out: os.Stderr}
+		log.SetFlags(0)
+		log.SetOutput(l)
+		SetLogger(l)
+	default:
+		return fmt.Errorf("--log-format には text または json を指定してください: %s", format)
+	}
+	return nil
+}
+
+// logWithFields は企業名などの項目を付けて logger にログを出力する。
+func logWithFields(level string, fields logFields, format string, args ...interface{}) {
+	logFieldsTo(logger, level, fields, format, args...)
+}
+
+// logFieldsTo は企業名などの項目を付けて l にログを出力する。
+// l が項目を扱えない場合 (text 形式など) は項目を付けずにメッセージのみを出力する。
+func logFieldsTo(l Logger, level string, fields logFields, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if fl, ok := l.(fieldLogger); ok {
+		fl.logFields(level, fields, message)
+		return
+	}
+	l.Printf("%s", message)
+}
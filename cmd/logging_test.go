@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recordingLogger は出力されたログを保持する Logger
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestLogWithFieldsJSONIndex(t *testing.T) {
+	var buf bytes.Buffer
+	l := &jsonLogger{out: &buf}
+	zero := 0
+	logFieldsTo(l, "info", logFields{Company: "トヨタ自動車", Index: &zero}, "%d: %s", 0, "トヨタ自動車")
+	logFieldsTo(l, "warn", logFields{Company: "7203", URL: "https://www.nikkei.com/"}, "リトライします")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	var row, retry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &retry); err != nil {
+		t.Fatal(err)
+	}
+	if index, ok := row["index"]; !ok || index != float64(0) {
+		t.Errorf("row log index = %v (present: %v), want 0", index, ok)
+	}
+	if index, ok := retry["index"]; ok {
+		t.Errorf("log without a row has index %v, want no index", index)
+	}
+	if retry["level"] != "warn" || retry["url"] != "https://www.nikkei.com/" {
+		t.Errorf("retry log = %v", retry)
+	}
+}
+
+func TestScraperLogger(t *testing.T) {
+	l := &recordingLogger{}
+	s := newTestScraper(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("searchKeyword") == "7203" {
+			http.Redirect(w, r, "/nkd/company/?scode=7203", http.StatusFound)
+			return
+		}
+		w.Write([]byte(emptySearchPage))
+	}))
+	s.Logger = l
+	s.NoHistory = true
+
+	result, err := s.FetchPrices(context.Background(), "トヨタ", "7203")
+	if err != nil {
+		t.Fatalf("FetchPrices() error = %v", err)
+	}
+	if result.StockCode != "7203" {
+		t.Fatalf("StockCode = %q, want 7203", result.StockCode)
+	}
+	if len(l.lines) != 1 || !strings.Contains(l.lines[0], "7203 で見つかりました") {
+		t.Errorf("Scraper.Logger got %q, want the fallback lookup log", l.lines)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// countRows はすべての入力ファイルのデータ行の数を数える。
+func countRows(srcs []inputSource, read inputReader) (int, error) {
+	// 読み飛ばす行の判定を揃えるため、実際の処理と同じ形式の read で行を数える。
+	// 警告が重複しないよう、read にはログを出力しないもの (discardLogger) を渡す
+	count := 0
+	for _, src := range srcs {
+		err := readSource(src, read, func(next rowIterator) error {
+			for {
+				_, ok, err := next()
+				if err != nil || !ok {
+					return err
+				}
+				count++
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// confirmMaxRows は処理する行数 rows が --max-rows の max を超えている場合に、続行してよいかを端末で確認する。
+// 端末から実行されていない場合は確認できないためエラーを返す。
+func confirmMaxRows(rows, max int) error {
+	message := fmt.Sprintf("処理する行数 %d 行が --max-rows の %d 行を超えています", rows, max)
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s (このまま処理する場合は --yes を指定してください)", message)
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	fmt.Fprintf(os.Stderr, "%s。続行しますか? [y/N]: ", message)
+	line, err := promptInput.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return fmt.Errorf("%s。確認の回答を読み込めなかったため処理を中止しました (このまま処理する場合は --yes を指定してください): %w", message, err)
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("%s。処理を中止しました", message)
+	}
+}
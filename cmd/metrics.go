@@ -0,0 +1,65 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingStats は --verbose の場合にリクエストや企業ごとの所要時間を種類ごとに記録する。
+type timingStats struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+}
+
+func newTimingStats() *timingStats {
+	return &timingStats{samples: map[string][]time.Duration{}}
+}
+
+func (t *timingStats) record(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples[name] = append(t.samples[name], d)
+}
+
+// logSummary は種類ごとの所要時間の最小・平均・最大・95 パーセンタイルを log に出力する。
+func (t *timingStats) logSummary(log Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.samples))
+	for name := range t.samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		samples := append([]time.Duration(nil), t.samples[name]...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		var total time.Duration
+		for _, d := range samples {
+			total += d
+		}
+		// 95 パーセンタイルは最も近い順位の値を使う
+		p95 := samples[(len(samples)*95+99)/100-1]
+		log.Printf("所要時間 %s: %d 件 min=%s avg=%s max=%s p95=%s", name, len(samples),
+			samples[0].Round(time.Millisecond), (total / time.Duration(len(samples))).Round(time.Millisecond),
+			samples[len(samples)-1].Round(time.Millisecond), p95.Round(time.Millisecond))
+	}
+}
+
+// requestKind は集計用にリクエスト先のページの種類 (search, yprice など) を返す。
+func requestKind(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "other"
+	}
+	return "request:" + path.Base(strings.TrimSuffix(u.Path, "/"))
+}
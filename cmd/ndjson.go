@@ -0,0 +1,65 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonRecord は --format ndjson で出力する 1 行分のデータ
+type ndjsonRecord struct {
+	Index int `json:"index"`
+	ScrapeResult
+}
+
+// ndjsonWriter はスクレイピング結果を 1 企業 1 行の JSON (JSON Lines) として書き込む。
+// 後続の処理が実行中から読み始められるよう、1 件ごとにファイルへ書き出す。
+type ndjsonWriter struct {
+	f   io.WriteCloser
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNdjsonWriter(path string, appendOutput, gzipOutput bool) (*ndjsonWriter, error) {
+	f, _, err := createOutputWriter(path, appendOutput, gzipOutput)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &ndjsonWriter{f: f, buf: buf, enc: enc}, nil
+}
+
+// WriteHeader は何もしない。JSON Lines にはヘッダが無い。
+func (n *ndjsonWriter) WriteHeader() error {
+	return nil
+}
+
+// WriteResult は 1 企業分の結果を 1 行の JSON として書き込む。
+func (n *ndjsonWriter) WriteResult(result ScrapeResult) error {
+	if err := n.enc.Encode(ndjsonRecord{Index: result.Index, ScrapeResult: result}); err != nil {
+		return err
+	}
+	if err := n.buf.Flush(); err != nil {
+		return err
+	}
+	return flushOutput(n.f)
+}
+
+// flush は何もしない。WriteResult で 1 件ごとに書き出している。
+func (n *ndjsonWriter) flush() error {
+	return nil
+}
+
+// Close はファイルを閉じる。
+func (n *ndjsonWriter) Close() error {
+	if err := n.buf.Flush(); err != nil {
+		n.f.Close()
+		return err
+	}
+	return n.f.Close()
+}
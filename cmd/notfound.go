@@ -0,0 +1,77 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// notFoundRow は日経のサイトで見つからなかった企業の入力ファイルでの位置を表す。
+type notFoundRow struct {
+	// 入力ファイルの番号 (--input に指定した順)
+	file      int
+	inputFile string
+	line      int
+	name      string
+}
+
+// notFoundRows は --notfound-output に書き出す企業を集める。
+// 処理は並行して行われるため、書き出す際に入力ファイルでの順番に並べ直す。
+type notFoundRows struct {
+	mu   sync.Mutex
+	rows []notFoundRow
+}
+
+func (n *notFoundRows) add(row notFoundRow) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.rows = append(n.rows, row)
+}
+
+// write は見つからなかった企業を入力ファイルでの順番に path に書き出す。
+// withInputFile が true の場合は入力ファイルの列も書き出す。
+func (n *notFoundRows) write(path, lang string, withInputFile bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sort.Slice(n.rows, func(i, j int) bool {
+		if n.rows[i].file != n.rows[j].file {
+			return n.rows[i].file < n.rows[j].file
+		}
+		return n.rows[i].line < n.rows[j].line
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	columns := []string{"企業名", "index"}
+	if withInputFile {
+		columns = append(columns, "入力ファイル")
+	}
+	if err := w.Write(localizeColumns(lang, columns)); err != nil {
+		f.Close()
+		return err
+	}
+	for _, row := range n.rows {
+		record := []string{row.name, strconv.Itoa(row.line)}
+		if withInputFile {
+			record = append(record, row.inputFile)
+		}
+		if err := w.Write(record); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,661 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputOptions は出力ファイルにどの列をどの形式で書き出すかを表す。
+type outputOptions struct {
+	// 1 行に 1 企業・1 年を出力する縦持ち形式にするかどうか
+	Long bool
+	// 月ごとの株価を出力するかどうか。月ごとの場合は常に 1 行に 1 企業・1 年月を出力する
+	Monthly bool
+
+	WithVolume, WithDividends, WithMetadata, WithValuation, WithFoundYears, WithProvenance bool
+	// 取得時点の現在値とその日時の列を出力するかどうか (--with-current-price)
+	WithCurrentPrice bool
+	// 年ごとの始値の列を出力するかどうか (--with-open)
+	WithOpen bool
+	// 終値を取得できた年の数の列を出力するかどうか (--with-years-found)
+	WithYearsFound bool
+	// データ品質スコアの列を出力するかどうか (--with-quality-score)
+	WithQualityScore bool
+	// 日経平均・TOPIX の構成銘柄かどうかの列を出力するかどうか
+	WithIndexMembership bool
+	// 株式分割の調整の有無と、調整されていない疑いのある年の列を出力するかどうか (--with-split-check)
+	WithSplitCheck bool
+	// 期間全体の高値・安値の列を出力するかどうか
+	WithPeriodRange bool
+	// 終値の解析前の文字列の列を出力するかどうか (--with-raw-prices)
+	WithRawPrices bool
+	// 年ごとの高値・安値を付けた日付の列を出力するかどうか (--dates-as-columns)
+	WithPriceDates bool
+	// 入力ファイルが複数ある場合に、企業名を読み込んだ入力ファイルの列を出力するかどうか
+	WithInputFile bool
+	// 株価の列 (終値など) を出力しないかどうか (--no-history)
+	WithoutHistory bool
+	// index の列を出力しないかどうか (--output-append-index=false)
+	WithoutIndex bool
+	// コードの列を先頭に出力するかどうか (--code-first)
+	CodeFirst bool
+	// 年間高安の表から取得した値のうち、出力する列の見出し (--fields)
+	Fields []string
+
+	// 出力する列 (outputFields のキー) とその順番。空の場合は上のフラグから決める
+	Columns []string
+	// 列ごとのヘッダ行の列名 (--header-template)。含まれない列は既定の列名にする
+	HeaderNames map[string]string
+	// 見つからなかった企業のコードと株価の列に書き出す値 (--notfound-value)。nil の場合はコードを空欄、株価を 0 にする
+	NotFoundValue *string
+
+	// 価格を出力する際の小数点以下の桁数
+	Precision int
+	// 整数の価格は小数点以下を付けずに出力するかどうか (--integer-prices)
+	IntegerPrices bool
+	// ヘッダ行の言語 (ja または en)
+	Lang string
+	// --format json の場合に 2 文字の空白でインデントするかどうか (--pretty)
+	Pretty bool
+	// 年ごとの列を出力する年とその順番 (--years)。空の場合は targetYears のすべての年
+	Years []int
+	// 年を行、企業を列にした終値の表を出力するかどうか (--transpose)
+	Transpose bool
+	// --transpose で列にする企業の数の上限 (--max-rows)。0 の場合は無制限
+	TransposeLimit int
+	// --format xlsx の場合に、値ごとにシートを分ける列 (--sheet-by)
+	SheetBy string
+	// CSV にヘッダ行を書き込まないかどうか (--no-header)
+	WithoutHeader bool
+	// CSV のすべての値をダブルクォートで囲むかどうか (--always-quote)
+	AlwaysQuote bool
+}
+
+// englishColumnNames は --lang en を指定した場合の列名
+var englishColumnNames = map[string]string{
+	"企業名":     "Company",
+	"index":   "Index",
+	"コード":     "Code",
+	"年":       "Year",
+	"年月":      "Month",
+	"終値":      "Close",
+	"始値":      "Open",
+	"出来高":     "Volume",
+	"配当":      "Dividend",
+	"上場市場":    "Market",
+	"業種":      "Industry",
+	"日経平均採用":  "Nikkei 225",
+	"TOPIX採用": "TOPIX",
+	"取得できた年":  "Found Years",
+	"取得できた年数": "Years Found",
+	"品質スコア":   "Quality Score",
+	"終値の表記":   "Close (Raw)",
+	"高値日":     "High Date",
+	"安値日":     "Low Date",
+	"分割調整":    "Split Adjusted",
+	"分割の疑い":   "Split Suspect Years",
+	"時価総額":    "Market Cap",
+	"現在値":     "Current Price",
+	"現在値の日時":  "Current Price At",
+	"期間高値":    "Period High",
+	"期間安値":    "Period Low",
+	"入力ファイル":  "Input File",
+	"エラー":     "Error",
+	"エラーの種類":  "Error Kind",
+}
+
+// localizeColumn は列名を lang に応じた言語に変換する。
+func localizeColumn(lang, name string) string {
+	if lang == "en" {
+		if en, ok := englishColumnNames[name]; ok {
+			return en
+		}
+	}
+	return name
+}
+
+// localizeColumns は列名の一覧を lang に応じた言語に変換する。
+func localizeColumns(lang string, names []string) []string {
+	columns := make([]string, len(names))
+	for i, name := range names {
+		columns[i] = localizeColumn(lang, name)
+	}
+	return columns
+}
+
+// outputRow は出力ファイルの 1 行分の元になるデータ。
+// 縦持ち形式の場合は Year (月ごとの場合は Month) にその行の年 (年月) が入る。
+type outputRow struct {
+	Line   int
+	Result ScrapeResult
+	Year   int
+	Month  string
+}
+
+// outputField は出力ファイルの列を表す。横持ち形式では年ごとの複数の列になるものもある。
+type outputField struct {
+	headers func(o outputOptions) []string
+	values  func(o outputOptions, row outputRow) []string
+}
+
+// singleField は 1 列だけの outputField を作る。
+func singleField(header string, value func(o outputOptions, row outputRow) string) outputField {
+	return outputField{
+		headers: func(o outputOptions) []string { return []string{localizeColumn(o.Lang, header)} },
+		values:  func(o outputOptions, row outputRow) []string { return []string{value(o, row)} },
+	}
+}
+
+// yearlyField は年ごとの値の列を作る。横持ち形式では "出来高2013" のように年ごとの列になる。
+func yearlyField(header string, value func(o outputOptions, result ScrapeResult, year int) string) outputField {
+	return outputField{
+		headers: func(o outputOptions) []string {
+			if o.Long {
+				return []string{localizeColumn(o.Lang, header)}
+			}
+			years := o.years()
+			headers := make([]string, len(years))
+			for i, year := range years {
+				headers[i] = fmt.Sprintf("%s%d", localizeColumn(o.Lang, header), year)
+			}
+			return headers
+		},
+		values: func(o outputOptions, row outputRow) []string {
+			if o.Long {
+				return []string{value(o, row.Result, row.Year)}
+			}
+			years := o.years()
+			values := make([]string, len(years))
+			for i, year := range years {
+				values[i] = value(o, row.Result, year)
+			}
+			return values
+		},
+	}
+}
+
+// outputFields は --columns で指定できる列
+var outputFields = map[string]outputField{
+	"company": singleField("企業名", func(o outputOptions, row outputRow) string { return row.Result.CompanyName }),
+	"index":   singleField("index", func(o outputOptions, row outputRow) string { return strconv.Itoa(row.Line) }),
+	"code":    singleField("コード", func(o outputOptions, row outputRow) string { return row.Result.StockCode }),
+	"year":    singleField("年", func(o outputOptions, row outputRow) string { return strconv.Itoa(row.Year) }),
+	"month":   singleField("年月", func(o outputOptions, row outputRow) string { return row.Month }),
+	"close": {
+		headers: func(o outputOptions) []string {
+			if o.Long || o.Monthly {
+				return []string{localizeColumn(o.Lang, "終値")}
+			}
+			// 横持ち形式の終値の列名は年のみ
+			years := o.years()
+			headers := make([]string, len(years))
+			for i, year := range years {
+				headers[i] = strconv.Itoa(year)
+			}
+			return headers
+		},
+		values: func(o outputOptions, row outputRow) []string {
+			if o.Monthly {
+				return []string{o.formatPrice(row.Result.MonthlyPrices[row.Month])}
+			}
+			if o.Long {
+				return []string{o.formatClose(row.Result, row.Year)}
+			}
+			years := o.years()
+			values := make([]string, len(years))
+			for i, year := range years {
+				values[i] = o.formatClose(row.Result, year)
+			}
+			return values
+		},
+	},
+	"open": yearlyField("始値", func(o outputOptions, result ScrapeResult, year int) string {
+		open, ok := result.Opens[year]
+		if !ok {
+			return ""
+		}
+		return o.formatPrice(open)
+	}),
+	"volume": yearlyField("出来高", func(o outputOptions, result ScrapeResult, year int) string {
+		volume, ok := result.Volumes[year]
+		if !ok && len(o.Years) > 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.0f", volume)
+	}),
+	"dividend": yearlyField("配当", func(o outputOptions, result ScrapeResult, year int) string {
+		return o.formatDividend(result, year)
+	}),
+	"raw_close": yearlyField("終値の表記", func(o outputOptions, result ScrapeResult, year int) string {
+		return result.RawPrices[year]
+	}),
+	"high_date": yearlyField("高値日", func(o outputOptions, result ScrapeResult, year int) string {
+		return result.HighDates[year]
+	}),
+	"low_date": yearlyField("安値日", func(o outputOptions, result ScrapeResult, year int) string {
+		return result.LowDates[year]
+	}),
+	"market":      singleField("上場市場", func(o outputOptions, row outputRow) string { return row.Result.Market }),
+	"industry":    singleField("業種", func(o outputOptions, row outputRow) string { return row.Result.Industry }),
+	"nikkei225":   singleField("日経平均採用", func(o outputOptions, row outputRow) string { return formatMembership(row.Result.Nikkei225) }),
+	"topix":       singleField("TOPIX採用", func(o outputOptions, row outputRow) string { return formatMembership(row.Result.TOPIX) }),
+	"per":         singleField("PER", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.PER) }),
+	"pbr":         singleField("PBR", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.PBR) }),
+	"market_cap":  singleField("時価総額", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.MarketCap) }),
+	"period_high": singleField("期間高値", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.PeriodHigh) }),
+	"period_low":  singleField("期間安値", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.PeriodLow) }),
+	"found_years": singleField("取得できた年", func(o outputOptions, row outputRow) string {
+		foundYears := row.Result.FoundYears()
+		years := make([]string, len(foundYears))
+		for i, year := range foundYears {
+			years[i] = strconv.Itoa(year)
+		}
+		return strings.Join(years, " ")
+	}),
+	"years_found":    singleField("取得できた年数", func(o outputOptions, row outputRow) string { return strconv.Itoa(len(row.Result.FoundYears())) }),
+	"split_adjusted": singleField("分割調整", func(o outputOptions, row outputRow) string { return formatMembership(row.Result.SplitAdjusted) }),
+	"split_suspect":  singleField("分割の疑い", func(o outputOptions, row outputRow) string { return formatYears(row.Result.SplitSuspectYears, " ") }),
+	"quality_score":  singleField("品質スコア", func(o outputOptions, row outputRow) string { return strconv.Itoa(qualityScore(row.Result)) }),
+	"fetched_at": singleField("fetched_at", func(o outputOptions, row outputRow) string {
+		if row.Result.FetchedAt.IsZero() {
+			return ""
+		}
+		return row.Result.FetchedAt.Format(time.RFC3339)
+	}),
+	"source_url": singleField("source_url", func(o outputOptions, row outputRow) string { return row.Result.SourceURL }),
+	"input_file": singleField("入力ファイル", func(o outputOptions, row outputRow) string { return row.Result.InputFile }),
+	// 取得時点の現在値 (--with-current-price)
+	"current_price":    singleField("現在値", func(o outputOptions, row outputRow) string { return formatOptional(row.Result.CurrentPrice) }),
+	"current_price_at": singleField("現在値の日時", func(o outputOptions, row outputRow) string { return row.Result.CurrentPriceAt }),
+}
+
+// parseColumns は --columns (flag) に指定されたカンマ区切りの列名を検証して返す。
+func parseColumns(flag, value string, long, monthly bool) ([]string, error) {
+	var columns []string
+	for _, column := range strings.Split(value, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		if _, ok := outputFields[column]; !ok {
+			names := make([]string, 0, len(outputFields))
+			for name := range outputFields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%s に不明な列 %q が指定されました。指定できる列: %s", flag, column, strings.Join(names, ", "))
+		}
+		switch {
+		case column == "year" && (!long || monthly):
+			return nil, fmt.Errorf("%s の year は --long を指定した場合のみ利用できます", flag)
+		case column == "month" && !monthly:
+			return nil, fmt.Errorf("%s の month は --granularity month を指定した場合のみ利用できます", flag)
+		case (column == "volume" || column == "dividend" || column == "period_high" || column == "period_low") && monthly:
+			return nil, fmt.Errorf("%s の %s は --granularity month の場合は利用できません", flag, column)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s に出力する列を指定してください", flag)
+	}
+	return columns, nil
+}
+
+// parseYears は --years に指定されたカンマ区切りの年を解析する。年は指定された順番のまま返す。
+func parseYears(value string) ([]int, error) {
+	var years []int
+	seen := map[int]bool{}
+	for _, text := range strings.Split(value, ",") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		year, err := strconv.Atoi(text)
+		if err != nil || !isTargetYear(year) {
+			return nil, fmt.Errorf("--years には %d 年から %d 年までの年を指定してください: %s", targetYears[0], targetYears[len(targetYears)-1], text)
+		}
+		if seen[year] {
+			return nil, fmt.Errorf("--years に同じ年が複数回指定されています: %d", year)
+		}
+		seen[year] = true
+		years = append(years, year)
+	}
+	if len(years) == 0 {
+		return nil, fmt.Errorf("--years に出力する年を指定してください")
+	}
+	return years, nil
+}
+
+// parseHeaderTemplate は --header-template に指定された "列=列名" のカンマ区切り (または改行区切り) を解釈し、
+// 出力する列とその順番、列ごとの列名を返す。"=列名" を省略した列は既定の列名にする。
+// 値が "@" で始まる場合はファイルから読み込む。
+func parseHeaderTemplate(value string, long, monthly bool) ([]string, map[string]string, error) {
+	value, err := readFlagValue(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("--header-template を読み込めませんでした: %w", err)
+	}
+	var columns []string
+	names := map[string]string{}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		column, name, hasName := strings.Cut(entry, "=")
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		if _, ok := names[column]; ok {
+			return nil, nil, fmt.Errorf("--header-template に列 %q が複数回指定されました", column)
+		}
+		names[column] = ""
+		if hasName {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return nil, nil, fmt.Errorf("--header-template の列 %q の列名が空です", column)
+			}
+			names[column] = name
+		}
+		columns = append(columns, column)
+	}
+	// 列名の検証は --columns と共通にする
+	columns, err = parseColumns("--header-template", strings.Join(columns, ","), long, monthly)
+	if err != nil {
+		return nil, nil, err
+	}
+	for column, name := range names {
+		if name == "" {
+			delete(names, column)
+		}
+	}
+	return columns, names, nil
+}
+
+// hasColumn は column が出力される列に含まれるかどうかを返す。
+func (o outputOptions) hasColumn(column string) bool {
+	for _, c := range o.columns() {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// years は年ごとの列を出力する年を返す。--years を指定した場合はその年を指定した順番で返す。
+func (o outputOptions) years() []int {
+	if len(o.Years) > 0 {
+		return o.Years
+	}
+	return targetYears
+}
+
+// columns は出力する列の一覧を返す。--fields で指定された値の列は最後に追加する。
+func (o outputOptions) columns() []string {
+	columns := o.baseColumns()
+	if len(o.Fields) == 0 {
+		return columns
+	}
+	columns = append([]string(nil), columns...)
+	for _, name := range o.Fields {
+		columns = append(columns, fieldColumnPrefix+name)
+	}
+	return columns
+}
+
+// field は列 column の outputField を返す。
+func (o outputOptions) field(column string) outputField {
+	if name := strings.TrimPrefix(column, fieldColumnPrefix); name != column {
+		return fieldOutput(name)
+	}
+	return outputFields[column]
+}
+
+// baseColumns は --fields の列を除いた、出力する列の一覧を返す。
+func (o outputOptions) baseColumns() []string {
+	if len(o.Columns) > 0 {
+		return o.Columns
+	}
+	columns := []string{"company"}
+	if o.CodeFirst {
+		columns = []string{"code", "company"}
+	}
+	if !o.WithoutIndex {
+		columns = append(columns, "index")
+	}
+	if !o.CodeFirst {
+		columns = append(columns, "code")
+	}
+	if o.Monthly {
+		columns = append(columns, "month")
+	} else if o.Long {
+		columns = append(columns, "year")
+	}
+	if !o.WithoutHistory {
+		columns = append(columns, "close")
+	}
+	if !o.Monthly {
+		if o.WithOpen {
+			columns = append(columns, "open")
+		}
+		if o.WithVolume {
+			columns = append(columns, "volume")
+		}
+		if o.WithDividends {
+			columns = append(columns, "dividend")
+		}
+		if o.WithRawPrices {
+			columns = append(columns, "raw_close")
+		}
+		if o.WithPriceDates {
+			columns = append(columns, "high_date", "low_date")
+		}
+	}
+	if o.WithPeriodRange && !o.Monthly {
+		columns = append(columns, "period_high", "period_low")
+	}
+	if o.WithMetadata {
+		columns = append(columns, "market", "industry")
+	}
+	if o.WithIndexMembership {
+		columns = append(columns, "nikkei225", "topix")
+	}
+	if o.WithValuation {
+		columns = append(columns, "per", "pbr", "market_cap")
+	}
+	if o.WithCurrentPrice {
+		columns = append(columns, "current_price", "current_price_at")
+	}
+	if o.WithFoundYears {
+		columns = append(columns, "found_years")
+	}
+	if o.WithYearsFound {
+		columns = append(columns, "years_found")
+	}
+	if o.WithSplitCheck && !o.Monthly {
+		columns = append(columns, "split_adjusted", "split_suspect")
+	}
+	if o.WithQualityScore {
+		columns = append(columns, "quality_score")
+	}
+	if o.WithProvenance {
+		columns = append(columns, "fetched_at", "source_url")
+	} else if o.WithValuation {
+		// PER などは取得時点の値のため、いつ取得したかを必ず出力する
+		columns = append(columns, "fetched_at")
+	}
+	if o.WithInputFile {
+		columns = append(columns, "input_file")
+	}
+	return columns
+}
+
+// formatPrice は価格を指定された桁数の文字列に変換する。
+// IntegerPrices の場合、整数の価格は小数点以下を付けずに出力する。
+func (o outputOptions) formatPrice(price float64) string {
+	if o.IntegerPrices && price == math.Trunc(price) {
+		return strconv.FormatFloat(price, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(price, 'f', o.Precision, 64)
+}
+
+// formatClose は year の終値を文字列に変換する。--years を指定した場合は、終値が無い年を 0 ではなく空欄にする。
+func (o outputOptions) formatClose(result ScrapeResult, year int) string {
+	price, ok := result.Prices[year]
+	if !ok && len(o.Years) > 0 {
+		return ""
+	}
+	return o.formatPrice(price)
+}
+
+// formatDividend は配当を文字列に変換する。配当が無い年は 0 ではなく空欄にする。
+func (o outputOptions) formatDividend(result ScrapeResult, year int) string {
+	dividend, ok := result.Dividends[year]
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(dividend, 'f', -1, 64)
+}
+
+// formatOptional は取得できなかった場合に nil になる値を文字列に変換する。nil の場合は空欄にする。
+func formatOptional(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// formatMembership は指数の構成銘柄かどうかを 1 / 0 に変換する。分からない場合は空欄にする。
+func formatMembership(value *bool) string {
+	switch {
+	case value == nil:
+		return ""
+	case *value:
+		return "1"
+	default:
+		return "0"
+	}
+}
+
+// header は出力ファイルのヘッダ行を返す。
+func (o outputOptions) header() []string {
+	var header []string
+	for _, column := range o.columns() {
+		headers := o.field(column).headers(o)
+		if name, ok := o.HeaderNames[column]; ok {
+			// 年ごとの列は "列名2013" のように列名の後ろに年を付ける
+			if len(headers) == 1 {
+				headers = []string{name}
+			} else {
+				for i, year := range o.years() {
+					headers[i] = fmt.Sprintf("%s%d", name, year)
+				}
+			}
+		}
+		header = append(header, headers...)
+	}
+	return header
+}
+
+// rows は 1 企業分の結果を出力ファイルの行の元になるデータに分ける。
+// 横持ち形式では 1 行、縦持ち形式では対象の年 (年月) の数だけ行を返す。
+func (o outputOptions) rows(line int, result ScrapeResult) []outputRow {
+	if o.Monthly {
+		months := make([]string, 0, len(result.MonthlyPrices))
+		for month := range result.MonthlyPrices {
+			months = append(months, month)
+		}
+		sort.Strings(months)
+		rows := make([]outputRow, len(months))
+		for i, month := range months {
+			rows[i] = outputRow{Line: line, Result: result, Month: month}
+		}
+		return rows
+	}
+	if o.Long {
+		years := o.years()
+		rows := make([]outputRow, len(years))
+		for i, year := range years {
+			rows[i] = outputRow{Line: line, Result: result, Year: year}
+		}
+		return rows
+	}
+	return []outputRow{{Line: line, Result: result}}
+}
+
+// notFoundColumns は --notfound-value を指定した場合に、見つからなかった企業で値を置き換える列。
+// コードと、株価の表や銘柄のページから取得する値の列 (--fields の列を含む) が対象。
+var notFoundColumns = map[string]bool{
+	"code": true, "close": true, "open": true, "volume": true, "dividend": true, "raw_close": true,
+	"high_date": true, "low_date": true, "per": true, "pbr": true, "market_cap": true,
+	"period_high": true, "period_low": true, "current_price": true, "current_price_at": true,
+}
+
+// isNotFoundColumn は column が見つからなかった企業で --notfound-value に置き換える列かどうかを返す。
+func isNotFoundColumn(column string) bool {
+	return notFoundColumns[column] || strings.HasPrefix(column, fieldColumnPrefix)
+}
+
+// records は 1 企業分の結果を出力ファイルの行に変換する。
+func (o outputOptions) records(line int, result ScrapeResult) [][]string {
+	rows := o.rows(line, result)
+	records := make([][]string, len(rows))
+	// 見つからなかった企業の株価は 0 と区別できるよう、指定された値に置き換える
+	notFound := result.StockCode == "" && o.NotFoundValue != nil
+	for i, row := range rows {
+		for _, column := range o.columns() {
+			values := o.field(column).values(o, row)
+			if notFound && isNotFoundColumn(column) {
+				for j := range values {
+					values[j] = *o.NotFoundValue
+				}
+			}
+			records[i] = append(records[i], values...)
+		}
+	}
+	return records
+}
+
+// formatPreview は --preview でログに出力する、1 企業分の解析結果を読みやすくした文字列を返す。
+// 取得できなかった値は "-" で表す。
+func formatPreview(line int, result ScrapeResult) string {
+	optional := func(value float64, ok bool) string {
+		if !ok {
+			return "-"
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d: %s (コード: %s)", line, result.CompanyName, result.StockCode)
+	if result.SourceURL != "" {
+		fmt.Fprintf(&b, " %s", result.SourceURL)
+	}
+	if len(result.MonthlyPrices) > 0 {
+		months := make([]string, 0, len(result.MonthlyPrices))
+		for month := range result.MonthlyPrices {
+			months = append(months, month)
+		}
+		sort.Strings(months)
+		for _, month := range months {
+			fmt.Fprintf(&b, "\n  %s 終値=%s", month, optional(result.MonthlyPrices[month], true))
+		}
+	} else {
+		for _, year := range targetYears {
+			price, hasPrice := result.Prices[year]
+			volume, hasVolume := result.Volumes[year]
+			dividend, hasDividend := result.Dividends[year]
+			fmt.Fprintf(&b, "\n  %d 終値=%s 出来高=%s 配当=%s", year,
+				optional(price, hasPrice), optional(volume, hasVolume), optional(dividend, hasDividend))
+		}
+	}
+	if result.Market != "" || result.Industry != "" {
+		fmt.Fprintf(&b, "\n  上場市場=%s 業種=%s", result.Market, result.Industry)
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/html/charset"
+)
+
+var parseCmd = &cobra.Command{
+	Use:   "parse <htmlfile>",
+	Short: "保存した株価のページの HTML を解析し、取得できた内容を JSON で表示します",
+	Long: `保存した株価のページの HTML を解析し、取得できた内容を JSON で表示します
+
+具体的な利用方法:
+  scrape-nikkei-past-price parse yprice.html
+  scrape-nikkei-past-price parse --granularity month mprice.html
+  scrape-nikkei-past-price parse --fields 高値,安値 --zero-is-error yprice.html
+
+日経のサイトから取得した場合と同じ処理で解析するため、日経のサイトにアクセスせずに解析の誤りを再現・確認できます。
+--history-section・--fields・--zero-is-error・--with-raw-prices はスクレイピングする場合と同じ意味です。
+出力は --format ndjson の 1 行と同じ形式です。`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		granularity, err := cmd.Flags().GetString("granularity")
+		if err != nil {
+			return err
+		}
+		if granularity != granularityYear && granularity != granularityMonth {
+			return fmt.Errorf("--granularity には year または month を指定してください: %s", granularity)
+		}
+		code, err := cmd.Flags().GetString("code")
+		if err != nil {
+			return err
+		}
+		scraper := NewScraper()
+		scraper.Granularity = granularity
+		scraper.HistorySection, err = cmd.Flags().GetString("history-section")
+		if err != nil {
+			return err
+		}
+		scraper.ZeroIsError, err = cmd.Flags().GetBool("zero-is-error")
+		if err != nil {
+			return err
+		}
+		scraper.KeepRawPrices, err = cmd.Flags().GetBool("with-raw-prices")
+		if err != nil {
+			return err
+		}
+		fields, err := cmd.Flags().GetString("fields")
+		if err != nil {
+			return err
+		}
+		if fields != "" {
+			if scraper.Fields, err = parseFields(fields); err != nil {
+				return err
+			}
+		}
+		if granularity == granularityMonth {
+			// 月間高安の表には年ごとの列が無いため、年間高安の表向けのオプションは使えない
+			for _, name := range []string{"fields", "with-raw-prices"} {
+				if cmd.Flags().Changed(name) {
+					return fmt.Errorf("--%s は --granularity month の場合は利用できません", name)
+				}
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// 保存したページは Shift_JIS などの場合もあるため、meta タグの文字コードに従って UTF-8 に変換する
+		r, err := charset.NewReader(f, "text/html")
+		if err != nil {
+			return err
+		}
+		doc, err := goquery.NewDocumentFromReader(r)
+		if err != nil {
+			return &ParseError{Kind: "ページの HTML ", Text: path, Err: err}
+		}
+
+		result := newScrapeResult("")
+		result.StockCode = code
+		// 保存したページを取得した日時の代わりに、ファイルの更新日時を使う
+		if info, err := f.Stat(); err == nil {
+			result.FetchedAt = info.ModTime()
+		}
+		parseErr := scraper.parsePricePage(doc, &result)
+
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+		// --zero-is-error などで解析に失敗した場合も、それまでに取得できた内容は表示する
+		return parseErr
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(parseCmd)
+
+	parseCmd.Flags().String("granularity", granularityYear, "ページの種類を指定してください (year: 年間高安, month: 月間高安)")
+	parseCmd.Flags().String("code", "", "出力の stock_code に入れるコードを指定してください")
+	parseCmd.Flags().String("history-section", defaultHistorySection, "年ごとの株価を取得する表の見出し (に含まれる文言) を指定してください。見つからない場合は年間高安（過去10年）の表から取得します")
+	parseCmd.Flags().String("fields", "", "年間高安の表から取得する列の見出しをカンマ区切りで指定してください (例: 始値,高値,安値,終値,出来高)")
+	parseCmd.Flags().Bool("zero-is-error", false, "終値が 0 の年がある場合を解析の失敗として扱います (内容を表示したうえで 0 以外の終了コードで終了します)")
+	parseCmd.Flags().Bool("with-raw-prices", false, "日経のサイトに表示されている終値の文字列 (解析前) を raw_prices に出力します")
+}
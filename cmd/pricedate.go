@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/width"
+)
+
+// priceDateYearPattern は日付の年として扱う 4 桁の数字。(1234) のような負数の表記と区別する
+var priceDateYearPattern = regexp.MustCompile(`^(19|20)\d{2}$`)
+
+// parsePriceDate は "1,234(12/30)" のような価格の後ろの括弧内から、その価格を付けた日付を ISO 8601 の形式で取得する。
+// 月日のみの場合は year の日付 ("2022-12-30")、年のみ・年月のみの場合は "2022"・"2022-12" とする。
+// 日付が無い場合や解釈できない場合は空文字列を返す。
+func parsePriceDate(text string, year int) string {
+	raw := width.Narrow.String(strings.Join(strings.Fields(text), ""))
+	open := strings.LastIndex(raw, "(")
+	if open < 0 || !strings.HasSuffix(raw, ")") {
+		return ""
+	}
+	content := raw[open+1 : len(raw)-1]
+	content = strings.NewReplacer("年", "/", "月", "/", "日", "", "-", "/").Replace(content)
+	parts := strings.Split(strings.TrimSuffix(content, "/"), "/")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return ""
+		}
+		numbers[i] = n
+	}
+	hasYear := priceDateYearPattern.MatchString(parts[0])
+	switch {
+	case len(parts) == 1 && hasYear:
+		return parts[0]
+	case len(parts) == 2 && hasYear:
+		if numbers[1] < 1 || numbers[1] > 12 {
+			return ""
+		}
+		return fmt.Sprintf("%04d-%02d", numbers[0], numbers[1])
+	case len(parts) == 2:
+		return formatPriceDate(year, numbers[0], numbers[1])
+	case len(parts) == 3 && hasYear:
+		return formatPriceDate(numbers[0], numbers[1], numbers[2])
+	}
+	return ""
+}
+
+// formatPriceDate は存在する日付であれば "2022-12-30" の形式にし、存在しない日付の場合は空文字列を返す。
+func formatPriceDate(year, month, day int) string {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// recordPriceDates は年間高安の表の 1 行から、その年の高値・安値を付けた日付を result に記録する。
+func recordPriceDates(cells *goquery.Selection, cols priceColumns, year int, result *ScrapeResult) {
+	if date := parsePriceDate(cells.Eq(cols.high).Text(), year); date != "" {
+		if result.HighDates == nil {
+			result.HighDates = map[int]string{}
+		}
+		result.HighDates[year] = date
+	}
+	if date := parsePriceDate(cells.Eq(cols.low).Text(), year); date != "" {
+		if result.LowDates == nil {
+			result.LowDates = map[int]string{}
+		}
+		result.LowDates[year] = date
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPrefix は --metrics-file に出力するメトリクス名の接頭辞
+const metricsPrefix = "scrape_nikkei"
+
+// requestDurationBuckets はリクエストの所要時間のヒストグラムのバケットの上限 (秒)
+var requestDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// requestHistogram はリクエスト先のページの種類ごとの所要時間のヒストグラム (--metrics-file)
+type requestHistogram struct {
+	mu sync.Mutex
+	// ページの種類ごとの、各バケット以下だったリクエストの件数 (累積ではない)
+	counts map[string][]uint64
+	sums   map[string]float64
+	totals map[string]uint64
+}
+
+func newRequestHistogram() *requestHistogram {
+	return &requestHistogram{
+		counts: map[string][]uint64{},
+		sums:   map[string]float64{},
+		totals: map[string]uint64{},
+	}
+}
+
+// observe はページの種類 page のリクエストの所要時間を記録する。
+func (h *requestHistogram) observe(page string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts, ok := h.counts[page]
+	if !ok {
+		counts = make([]uint64, len(requestDurationBuckets))
+		h.counts[page] = counts
+	}
+	seconds := d.Seconds()
+	for i, le := range requestDurationBuckets {
+		if seconds <= le {
+			counts[i]++
+			break
+		}
+	}
+	h.sums[page] += seconds
+	h.totals[page]++
+}
+
+// writeMetrics は集計結果とリクエストの所要時間を Prometheus のテキスト形式で path に書き出す。
+// node_exporter の textfile collector が書き込み途中のファイルを読まないよう、一時ファイルに書いてから置き換える。
+func writeMetrics(path string, report *runReport, requests *requestHistogram, retries int64, runErr error) error {
+	var b bytes.Buffer
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+
+	report.mu.Lock()
+	metric("companies_processed_total", "counter", "Number of companies processed in the last run.")
+	fmt.Fprintf(&b, "%s_companies_processed_total %d\n", metricsPrefix, report.Found+report.NotFound+report.Errored)
+	metric("companies_found_total", "counter", "Number of companies found on Nikkei in the last run.")
+	fmt.Fprintf(&b, "%s_companies_found_total %d\n", metricsPrefix, report.Found)
+	metric("companies_not_found_total", "counter", "Number of companies not found on Nikkei in the last run.")
+	fmt.Fprintf(&b, "%s_companies_not_found_total %d\n", metricsPrefix, report.NotFound)
+	metric("errors_total", "counter", "Number of companies that failed in the last run, by error kind.")
+	kinds := make([]string, 0, len(report.Errors))
+	for kind := range report.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "%s_errors_total{kind=%q} %d\n", metricsPrefix, kind, report.Errors[kind])
+	}
+	startedAt := report.StartedAt
+	report.mu.Unlock()
+	metric("retries_total", "counter", "Number of request retries in the last run.")
+	fmt.Fprintf(&b, "%s_retries_total %d\n", metricsPrefix, retries)
+
+	success := 0
+	if runErr == nil {
+		success = 1
+	}
+	metric("last_run_success", "gauge", "Whether the last run completed without error (1) or not (0).")
+	fmt.Fprintf(&b, "%s_last_run_success %d\n", metricsPrefix, success)
+	metric("last_run_timestamp_seconds", "gauge", "Unix time when the last run finished.")
+	fmt.Fprintf(&b, "%s_last_run_timestamp_seconds %d\n", metricsPrefix, time.Now().Unix())
+	metric("last_run_duration_seconds", "gauge", "Duration of the last run in seconds.")
+	fmt.Fprintf(&b, "%s_last_run_duration_seconds %s\n", metricsPrefix, formatMetricValue(time.Since(startedAt).Seconds()))
+
+	if requests != nil {
+		requests.mu.Lock()
+		metric("request_duration_seconds", "histogram", "Time until response headers were received from Nikkei, by page.")
+		pages := make([]string, 0, len(requests.counts))
+		for page := range requests.counts {
+			pages = append(pages, page)
+		}
+		sort.Strings(pages)
+		for _, page := range pages {
+			var cumulative uint64
+			for i, le := range requestDurationBuckets {
+				cumulative += requests.counts[page][i]
+				fmt.Fprintf(&b, "%s_request_duration_seconds_bucket{page=%q,le=%q} %d\n", metricsPrefix, page, formatMetricValue(le), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_request_duration_seconds_bucket{page=%q,le=\"+Inf\"} %d\n", metricsPrefix, page, requests.totals[page])
+			fmt.Fprintf(&b, "%s_request_duration_seconds_sum{page=%q} %s\n", metricsPrefix, page, formatMetricValue(requests.sums[page]))
+			fmt.Fprintf(&b, "%s_request_duration_seconds_count{page=%q} %d\n", metricsPrefix, page, requests.totals[page])
+		}
+		requests.mu.Unlock()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// textfile collector が読めるよう、CreateTemp の 0600 ではなく通常のファイルと同じ権限にする
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// formatMetricValue は Prometheus のテキスト形式の数値に変換する。
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// metricsPage は requestKind の値からヒストグラムのラベルに使うページの種類を返す。
+func metricsPage(kind string) string {
+	return strings.TrimPrefix(kind, "request:")
+}
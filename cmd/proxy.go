@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyWindow はプロキシを一時的に外すかどうかを判定する際に参照する、プロキシごとの直近のリクエストの件数
+	proxyWindow = 10
+	// proxyDropFailures は直近 proxyWindow 件のうち、この件数が失敗したプロキシを一時的に外す
+	proxyDropFailures = 5
+)
+
+// proxyCooldown は失敗が続いたプロキシを使わない時間 (--proxy-cooldown)
+var proxyCooldown = 5 * time.Minute
+
+// proxyPool は有効なプロキシの状態
+var proxyPool *rotatingProxies
+
+// readProxyList は --proxy-list のファイルから 1 行に 1 つのプロキシの URL を読み込む。
+// 空行と # で始まる行は読み飛ばす。
+func readProxyList(path string) ([]string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--proxy-list を読み込めませんでした: %w", err)
+	}
+	var proxies []string
+	scanner := bufio.NewScanner(bytes.NewReader(trimBOM(src)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	return proxies, scanner.Err()
+}
+
+// parseProxyURL はプロキシの URL を解釈する。
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("プロキシの URL が不正です: %s", proxyURL)
+	}
+	return u, nil
+}
+
+// proxyState は 1 つのプロキシの集計と、一時的に外しているかどうか
+type proxyState struct {
+	url       *url.URL
+	transport *http.Transport
+	// 実行全体のリクエストと失敗の件数
+	requests, failures int
+	// 直近のリクエストが失敗したかどうか (リングバッファ)
+	recent [proxyWindow]bool
+	next   int
+	// この時刻までは使わない
+	droppedUntil time.Time
+}
+
+// rotatingProxies は複数のプロキシをリクエストごとに順番に使う http.RoundTripper。
+// 接続の失敗や 403 / 429 が続いたプロキシは proxyCooldown の間使わず、すべて外れている場合は最も早く戻るものを使う。
+type rotatingProxies struct {
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+}
+
+// newRotatingProxies は proxyURLs のプロキシごとに base を複製した Transport を使う rotatingProxies を作る。
+func newRotatingProxies(base *http.Transport, proxyURLs []*url.URL) *rotatingProxies {
+	r := &rotatingProxies{}
+	for _, u := range proxyURLs {
+		transport := base.Clone()
+		transport.Proxy = http.ProxyURL(u)
+		r.proxies = append(r.proxies, &proxyState{url: u, transport: transport})
+	}
+	return r
+}
+
+// pick は次に使うプロキシを選ぶ。
+func (r *rotatingProxies) pick() *proxyState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var soonest *proxyState
+	for i := 0; i < len(r.proxies); i++ {
+		p := r.proxies[(r.next+i)%len(r.proxies)]
+		if !now.Before(p.droppedUntil) {
+			r.next = (r.next + i + 1) % len(r.proxies)
+			return p
+		}
+		if soonest == nil || p.droppedUntil.Before(soonest.droppedUntil) {
+			soonest = p
+		}
+	}
+	return soonest
+}
+
+// observe はプロキシ p を使ったリクエストの結果を記録し、失敗が続いている場合は一時的に外す。
+func (r *rotatingProxies) observe(p *proxyState, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.requests++
+	if failed {
+		p.failures++
+	}
+	p.recent[p.next] = failed
+	p.next = (p.next + 1) % proxyWindow
+	recentFailures := 0
+	for _, f := range p.recent {
+		if f {
+			recentFailures++
+		}
+	}
+	if recentFailures < proxyDropFailures {
+		return
+	}
+	p.droppedUntil = time.Now().Add(proxyCooldown)
+	p.recent = [proxyWindow]bool{}
+	logger.Printf("プロキシ %s は直近 %d 件中 %d 件が失敗したため、%s の間使いません", p.url.Redacted(), proxyWindow, recentFailures, proxyCooldown)
+}
+
+func (r *rotatingProxies) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := r.pick()
+	resp, err := p.transport.RoundTrip(req)
+	failed := err != nil
+	if err == nil {
+		failed = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden
+	}
+	// 呼び出し元が中断したリクエストはプロキシの失敗として数えない
+	if req.Context().Err() == nil {
+		r.observe(p, failed)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections はすべてのプロキシの Transport の待機中の接続を閉じる。
+func (r *rotatingProxies) CloseIdleConnections() {
+	for _, p := range r.proxies {
+		p.transport.CloseIdleConnections()
+	}
+}
+
+// logSummary はプロキシごとのリクエストと失敗の件数をログに出力する。
+func (r *rotatingProxies) logSummary() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.proxies {
+		rate := 0.0
+		if p.requests > 0 {
+			rate = float64(p.failures) / float64(p.requests) * 100
+		}
+		logger.Printf("プロキシ %s: リクエスト %d 件, 失敗 %d 件 (%.1f%%)", p.url.Redacted(), p.requests, p.failures, rate)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+// データ品質スコア (--with-quality-score) の配点。合計が 100 点になるようにする
+const (
+	// コードが見つかった場合の点数
+	qualityCodePoints = 40
+	// 出力対象の年のうち終値を取得できた年の割合に応じた点数の上限
+	qualityYearsPoints = 40
+	// 0 以下の終値が無い場合の点数
+	qualityPricePoints = 10
+	// 株式分割が調整されていない疑いのある年が無い場合の点数
+	qualitySplitPoints = 10
+)
+
+// qualityScore は result のデータの信頼度を 0 から 100 の整数で返す。
+// コードが見つからなかった企業は、ほかの値も取得できないため 0 点にする。
+func qualityScore(result ScrapeResult) int {
+	if result.StockCode == "" {
+		return 0
+	}
+	score := qualityCodePoints
+	if len(targetYears) > 0 {
+		score += qualityYearsPoints * len(result.FoundYears()) / len(targetYears)
+	}
+	implausible := false
+	for _, year := range targetYears {
+		if price, ok := result.Prices[year]; ok && price <= 0 {
+			implausible = true
+			break
+		}
+	}
+	if !implausible {
+		score += qualityPricePoints
+	}
+	if len(result.SplitSuspectYears) == 0 {
+		score += qualitySplitPoints
+	}
+	return score
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// runReport は --report で出力する実行結果の集計
+type runReport struct {
+	mu sync.Mutex
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// 最後まで処理できた場合は true。途中で中断した場合は Error に理由が入る
+	Completed bool   `json:"completed"`
+	Error     string `json:"error,omitempty"`
+
+	Found    int `json:"found"`
+	NotFound int `json:"not_found"`
+	Errored  int `json:"errored"`
+	// --require-complete で終値が欠けている年があるため出力しなかった企業の数
+	Incomplete int `json:"incomplete"`
+	// --min-price の条件を満たさないため出力しなかった企業の数
+	Screened int `json:"screened"`
+	// --deadline-per-file を過ぎたため最後まで処理できなかった入力ファイル
+	IncompleteFiles []string `json:"incomplete_files,omitempty"`
+	// エラーの種類ごとの件数
+	Errors map[string]int `json:"errors"`
+	// 実行全体でリトライした回数
+	Retries int64 `json:"retries"`
+
+	// 指定されたフラグ (設定ファイルで指定されたものを含む)
+	Flags map[string]string `json:"flags"`
+}
+
+func newRunReport(flags *pflag.FlagSet) *runReport {
+	report := &runReport{
+		StartedAt: time.Now(),
+		Errors:    map[string]int{},
+		Flags:     map[string]string{},
+	}
+	flags.Visit(func(f *pflag.Flag) {
+		report.Flags[f.Name] = f.Value.String()
+	})
+	return report
+}
+
+// recordResult は 1 企業分の処理結果を集計する。
+func (r *runReport) recordResult(found bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if found {
+		r.Found++
+	} else {
+		r.NotFound++
+	}
+}
+
+// recordIncomplete は終値が欠けている年があるため出力しなかった企業を集計する (--require-complete)。
+func (r *runReport) recordIncomplete() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Incomplete++
+}
+
+// recordScreened は --min-price の条件を満たさないため出力しなかった企業を集計する。
+func (r *runReport) recordScreened() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Screened++
+}
+
+// recordIncompleteFile は --deadline-per-file を過ぎたため最後まで処理できなかった入力ファイルを記録する。
+func (r *runReport) recordIncompleteFile(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.IncompleteFiles = append(r.IncompleteFiles, path)
+}
+
+// notFoundRatio は処理した企業のうち見つからなかった企業の割合を返す。
+func (r *runReport) notFoundRatio() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := r.Found + r.NotFound + r.Errored
+	if total == 0 {
+		return 0
+	}
+	return float64(r.NotFound) / float64(total)
+}
+
+// recordError は 1 企業分の処理の失敗を種類ごとに集計する。
+func (r *runReport) recordError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errored++
+	r.Errors[errorKind(err)]++
+}
+
+// errorKind はエラーを集計用の種類に分類する。
+func errorKind(err error) string {
+	var pe *panicError
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrBlocked):
+		return "blocked"
+	case errors.Is(err, ErrCompanyNotFound):
+		return "not_found"
+	case errors.Is(err, ErrInvalidStockCode):
+		return "invalid_code"
+	case errors.As(err, &pe):
+		return "panic"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrHTTPStatus):
+		return "http_status"
+	case errors.Is(err, ErrParse):
+		return "parse"
+	case errors.As(err, &ne):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// write は集計結果を path に JSON で書き出す。retries は実行全体でリトライした回数。
+// runErr は実行全体のエラーで、nil の場合は最後まで処理できたことを表す。
+func (r *runReport) write(path string, retries int64, runErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FinishedAt = time.Now()
+	r.Completed = runErr == nil
+	r.Retries = retries
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0666)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BackoffPolicy はリトライの間隔 (指数バックオフ) を表す。
+type BackoffPolicy struct {
+	// 1 回目のリトライまでの間隔
+	Base time.Duration
+	// リトライごとに間隔を何倍にするか
+	Multiplier float64
+	// 間隔の上限
+	Max time.Duration
+	// true の場合は 0 から計算した間隔までの一様乱数にする (full jitter)
+	Jitter bool
+}
+
+// defaultBackoff は --backoff-* の既定値
+var defaultBackoff = BackoffPolicy{Base: 500 * time.Millisecond, Multiplier: 2, Max: 30 * time.Second, Jitter: true}
+
+// retryCounter は同じ Scraper でリトライした回数を数える。
+type retryCounter struct {
+	count int64
+	// 上限 (--retry-budget) に達したことを一度だけログに出力する
+	exhausted sync.Once
+}
+
+// リトライの対象となる失敗の種類 (classifyRetry)
+const (
+	// リトライしても結果が変わらない失敗 (404 などの 4xx) や、キャンセルされた場合
+	retryNone = ""
+	// 応答が無かった場合 (--per-request-timeout やソケットのタイムアウト)
+	retryTimeout = "timeout"
+	// 接続の失敗など、応答を受け取れなかった場合
+	retryNetwork = "network"
+	// 429 や 5xx が返った場合
+	retryStatus = "status"
+)
+
+// classifyRetry はリクエストの結果がリトライの対象かどうかを分類する。
+// err は client.Do のエラー、statusCode は err が nil の場合のステータスコード。
+// 429 以外の 4xx はページが無いなど確定した結果のため、すぐに失敗として扱う。
+func classifyRetry(err error, statusCode int) string {
+	var ne net.Error
+	switch {
+	case err == nil && retryableStatus(statusCode):
+		return retryStatus
+	case err == nil:
+		return retryNone
+	case errors.Is(err, context.Canceled):
+		return retryNone
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return retryTimeout
+	default:
+		return retryNetwork
+	}
+}
+
+// retryLimit は失敗の種類 kind をリトライする最大回数を返す。
+func (s *Scraper) retryLimit(kind string) int {
+	switch kind {
+	case retryNone:
+		return 0
+	case retryTimeout, retryNetwork:
+		if s.TimeoutRetries >= 0 {
+			return s.TimeoutRetries
+		}
+	}
+	return s.Retries
+}
+
+// takeRetry はリトライした回数を 1 増やす。RetryBudget の上限に達している場合は増やさずに false を返す。
+func (s *Scraper) takeRetry() bool {
+	if s.retries == nil {
+		return true
+	}
+	for {
+		n := atomic.LoadInt64(&s.retries.count)
+		if s.RetryBudget > 0 && n >= s.RetryBudget {
+			s.retries.exhausted.Do(func() {
+				s.logf("リトライの回数が --retry-budget の %d 回に達したため、以降は失敗してもリトライしません", s.RetryBudget)
+			})
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.retries.count, n, n+1) {
+			return true
+		}
+	}
+}
+
+// totalRetries はこの Scraper でリトライした回数を返す。
+func (s *Scraper) totalRetries() int64 {
+	if s.retries == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.retries.count)
+}
+
+// requestSubject はリトライのログに出力する、リクエストの対象 (検索した企業名やコード) を URL から取り出す。
+// 分からない場合は URL をそのまま返す。
+func requestSubject(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	for _, key := range []string{"scode", "searchKeyword"} {
+		if v := q.Get(key); v != "" {
+			return v
+		}
+	}
+	return rawURL
+}
+
+// validate は設定値が正しいかを確認する。
+func (p BackoffPolicy) validate() error {
+	switch {
+	case p.Base <= 0:
+		return fmt.Errorf("--backoff-base には 0 より大きい値を指定してください: %s", p.Base)
+	case p.Multiplier < 1:
+		return fmt.Errorf("--backoff-multiplier には 1 以上の値を指定してください: %g", p.Multiplier)
+	case p.Max < p.Base:
+		return fmt.Errorf("--backoff-max には --backoff-base (%s) 以上の値を指定してください: %s", p.Base, p.Max)
+	}
+	return nil
+}
+
+// delay は attempt 回目 (0 始まり) のリトライまでの待ち時間を返す。
+// 待ち時間は Base * Multiplier^attempt を Max で頭打ちにしたもので、Jitter の場合は 0 からその値までの乱数になる。
+func (p BackoffPolicy) delay(attempt int) time.Duration {
+	d := float64(p.Base) * math.Pow(p.Multiplier, float64(attempt))
+	if d > float64(p.Max) || math.IsInf(d, 0) {
+		d = float64(p.Max)
+	}
+	if p.Jitter {
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+	return time.Duration(d)
+}
+
+// retryableStatus はリトライすると成功する可能性があるステータスコードかどうかを返す。
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sleepContext は d だけ待機する。待機中に reqCtx がキャンセルされた場合は false を返す。
+func sleepContext(reqCtx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-reqCtx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
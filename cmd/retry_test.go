@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError は Timeout が true の net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyRetry(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		want       string
+	}{
+		{name: "200", statusCode: http.StatusOK, want: retryNone},
+		{name: "404", statusCode: http.StatusNotFound, want: retryNone},
+		{name: "403", statusCode: http.StatusForbidden, want: retryNone},
+		{name: "429", statusCode: http.StatusTooManyRequests, want: retryStatus},
+		{name: "500", statusCode: http.StatusInternalServerError, want: retryStatus},
+		{name: "502", statusCode: http.StatusBadGateway, want: retryStatus},
+		{name: "503", statusCode: http.StatusServiceUnavailable, want: retryStatus},
+		{name: "504", statusCode: http.StatusGatewayTimeout, want: retryStatus},
+		{name: "canceled", err: context.Canceled, want: retryNone},
+		{name: "canceled in url.Error", err: &url.Error{Op: "Get", URL: "https://www.nikkei.com/", Err: context.Canceled}, want: retryNone},
+		{name: "deadline", err: context.DeadlineExceeded, want: retryTimeout},
+		{name: "wrapped deadline", err: fmt.Errorf("リクエストに失敗しました: %w", context.DeadlineExceeded), want: retryTimeout},
+		{name: "net timeout", err: &url.Error{Op: "Get", URL: "https://www.nikkei.com/", Err: timeoutError{}}, want: retryTimeout},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "https://www.nikkei.com/", Err: refused}, want: retryNetwork},
+		{name: "other error", err: errors.New("unexpected EOF"), want: retryNetwork},
+	}
+	for _, tt := range tests {
+		if got := classifyRetry(tt.err, tt.statusCode); got != tt.want {
+			t.Errorf("%s: classifyRetry(%v, %d) = %q, want %q", tt.name, tt.err, tt.statusCode, got, tt.want)
+		}
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	s := NewScraper()
+	s.Retries = 3
+	for kind, want := range map[string]int{retryNone: 0, retryStatus: 3, retryTimeout: 3, retryNetwork: 3} {
+		if got := s.retryLimit(kind); got != want {
+			t.Errorf("retryLimit(%q) = %d, want %d", kind, got, want)
+		}
+	}
+	// --timeout-retries はタイムアウトと接続の失敗だけに使う
+	s.TimeoutRetries = 1
+	for kind, want := range map[string]int{retryNone: 0, retryStatus: 3, retryTimeout: 1, retryNetwork: 1} {
+		if got := s.retryLimit(kind); got != want {
+			t.Errorf("retryLimit(%q) with --timeout-retries 1 = %d, want %d", kind, got, want)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	p := BackoffPolicy{Base: 500 * time.Millisecond, Multiplier: 2, Max: 5 * time.Second}
+	// Jitter が無い場合は Base から倍になり、Max で頭打ちになる
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, w := range want {
+		if got := p.delay(attempt); got != w {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, w)
+		}
+	}
+	// 回数が多くても桁あふれせずに Max になる
+	for _, attempt := range []int{64, 1000} {
+		if got := p.delay(attempt); got != p.Max {
+			t.Errorf("delay(%d) = %s, want %s", attempt, got, p.Max)
+		}
+	}
+
+	// Jitter の場合は 0 から Jitter が無い場合の間隔までに収まる
+	p.Jitter = true
+	for attempt, bound := range append(want, p.Max) {
+		for i := 0; i < 200; i++ {
+			if got := p.delay(attempt); got < 0 || got > bound {
+				t.Fatalf("delay(%d) with jitter = %s, want between 0 and %s", attempt, got, bound)
+			}
+		}
+	}
+}
+
+func TestBackoffPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  BackoffPolicy
+		wantErr bool
+	}{
+		{name: "default", policy: defaultBackoff},
+		{name: "max equals base", policy: BackoffPolicy{Base: time.Second, Multiplier: 1, Max: time.Second}},
+		{name: "zero base", policy: BackoffPolicy{Base: 0, Multiplier: 2, Max: time.Second}, wantErr: true},
+		{name: "shrinking multiplier", policy: BackoffPolicy{Base: time.Second, Multiplier: 0.5, Max: time.Second}, wantErr: true},
+		{name: "max below base", policy: BackoffPolicy{Base: time.Second, Multiplier: 2, Max: time.Millisecond}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate() error = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
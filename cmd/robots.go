@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// robotsRule は robots.txt の Allow / Disallow の 1 行を表す。
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsRules は robots.txt のうち User-agent: * に対するルールを保持する。
+type robotsRules struct {
+	rules []robotsRule
+	// 禁止されているパスも警告のみ出力して取得するかどうか (--force)
+	force bool
+	// force の場合の警告を一度だけ出力する
+	warned sync.Once
+}
+
+// parseRobots は robots.txt を解析し、User-agent: * のグループのルールを返す。
+func parseRobots(r io.Reader) (*robotsRules, error) {
+	rules := &robotsRules{}
+	scanner := bufio.NewScanner(r)
+	inGroup := false
+	lastWasAgent := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// 連続する User-agent 行は同じグループとして扱う
+			if !lastWasAgent {
+				inGroup = false
+			}
+			if value == "*" {
+				inGroup = true
+			}
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			if inGroup && value != "" {
+				rules.rules = append(rules.rules, robotsRule{
+					allow:   key == "allow",
+					pattern: value,
+					re:      robotsPatternToRegexp(value),
+				})
+			}
+		}
+		lastWasAgent = false
+	}
+	return rules, scanner.Err()
+}
+
+// robotsPatternToRegexp は robots.txt のパス (* と末尾の $ に対応) を正規表現に変換する。
+func robotsPatternToRegexp(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed は path へのアクセスが許可されているかを返す。
+// 最も長く一致したルールを採用し、同じ長さの場合は Allow を優先する。
+func (r *robotsRules) allowed(path string) bool {
+	matched := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > matched || (len(rule.pattern) == matched && rule.allow) {
+			matched = len(rule.pattern)
+			allow = rule.allow
+		}
+	}
+	return allow
+}
+
+// checkRobots は --respect-robots で robots.txt を読み込んでいる場合に、rawURL が禁止されていないかを確認する。
+// --force が指定されている場合は警告のみ出力して許可する。
+func (s *Scraper) checkRobots(rawURL string) error {
+	if s.robots == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if s.robots.allowed(path) {
+		return nil
+	}
+	if s.robots.force {
+		s.robots.warned.Do(func() {
+			s.logf("robots.txt で禁止されているパスですが --force が指定されているため取得します: %s", u.Path)
+		})
+		return nil
+	}
+	return fmt.Errorf("robots.txt で禁止されているパスのため取得しません (--force で無視できます): %s", u.Path)
+}
+
+// loadRobots は日経のサイトの robots.txt を取得して解析する。
+func (s *Scraper) loadRobots(ctx context.Context) (*robotsRules, error) {
+	resp, err := s.httpGet(ctx, s.Client, s.BaseURL+"/robots.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		// robots.txt が無い場合はすべて許可されている
+		return &robotsRules{}, nil
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("robots.txt の取得でステータスコード %d が返りました", resp.StatusCode)
+	}
+	return parseRobots(resp.Body)
+}
@@ -5,18 +5,28 @@ package cmd
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/saintfish/chardet"
@@ -24,31 +34,68 @@ import (
 	"golang.org/x/net/html/charset"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/text/transform"
+	"golang.org/x/text/width"
 )
 
-var ctx = context.TODO()
+// workerRamp は起動直後に全ワーカーが一斉にリクエストを送らないよう、ワーカーの開始を少しずつずらす (--ramp-up)。
+// CLI では入力ファイルが複数ある場合も実行全体で 1 つを使い、最初のファイルの開始時だけずらす。
+type workerRamp struct {
+	// 最初のワーカーから workers 個目のワーカーが動き始めるまでの時間
+	duration time.Duration
+	// duration の間に少しずつ動き始めるワーカーの数 (--concurrency)
+	workers int64
+	// これまでに動き始めたワーカーの数
+	started int64
+}
 
-func openInputFile(path string) ([]byte, error) {
-	// read file
-	bytes, err := os.ReadFile(path)
-	if err != nil {
-		switch {
-		case errors.Is(err, syscall.ENOENT):
-			return nil, fmt.Errorf("入力されたファイルが見つかりませんでした: %s", path)
-		default:
-			return nil, err
-		}
+// wait は最初の workers 個のワーカーの開始を、duration の間に少しずつゆらぎを加えてずらす。
+func (r *workerRamp) wait(ctx context.Context) {
+	if r == nil || r.duration <= 0 || r.workers <= 0 {
+		return
+	}
+	n := atomic.AddInt64(&r.started, 1) - 1
+	if n >= r.workers {
+		return
+	}
+	slot := r.duration / time.Duration(r.workers)
+	delay := time.Duration(n)*slot + time.Duration(rand.Int63n(int64(slot)+1))
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
+
+// waitMinDelay は MinDelay に最大 20% のゆらぎを加えた時間だけ待機する。
+// --adaptive-delay の場合は、日経のサイトの制限の状況に応じて調整した間隔を使う。
+func (s *Scraper) waitMinDelay(ctx context.Context) {
+	base := s.MinDelay
+	if s.adaptive != nil {
+		base = s.adaptive.interval()
+	}
+	if base <= 0 {
+		return
+	}
+	delay := base + time.Duration(rand.Int63n(int64(base)/5+1))
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
 	}
+}
 
-	// encode detect
-	d := chardet.NewTextDetector()
-	r, err := d.DetectBest(bytes)
+// openInputFile は入力ファイルを読み込み、UTF-8 に変換して返す。
+// encoding が空の場合はエンコーディングを自動で判定し、判定できなかった場合は UTF-8 として読み込む。
+func openInputFile(ctx context.Context, path, encoding string) ([]byte, error) {
+	bytes, err := readInputFile(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	e, _ := charset.Lookup(r.Charset)
+
+	if encoding == "" {
+		encoding = detectEncoding(path, bytes)
+	}
+	e, _ := charset.Lookup(encoding)
 	if e == nil {
-		return nil, fmt.Errorf("入力ファイルのエンコーディングが不明です: %s", r.Charset)
+		return nil, fmt.Errorf("入力ファイルのエンコーディングが不明です: %s", encoding)
 	}
 	decodeStr, _, err := transform.Bytes(
 		e.NewDecoder(),
@@ -57,284 +104,2890 @@ func openInputFile(path string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return decodeStr, nil
+	return trimBOM(decodeStr), nil
 }
 
-func readCsv(sem *semaphore.Weighted, src []byte, skipHeader int, action func(number int, name string) error) error {
-	r := csv.NewReader(bytes.NewReader(src))
-	for i := 0; i < skipHeader; i++ {
-		_, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+// readInputFile は入力ファイルをそのまま読み込む。path が http(s) の URL の場合は HTTP で取得する。
+func readInputFile(ctx context.Context, path string) ([]byte, error) {
+	if isInputURL(path) {
+		return fetchInputURL(ctx, path)
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.ENOENT):
+			return nil, fmt.Errorf("入力されたファイルが見つかりませんでした: %s", path)
+		default:
+			return nil, err
 		}
 	}
+	return bytes, nil
+}
 
-	i := 0
-	for {
-		j := i + skipHeader
-		record, err := r.Read()
-		i++
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
+// utf8BOM は UTF-8 の BOM。UTF-16 の BOM も UTF-8 に変換した後はこの形になる
+var utf8BOM = []byte("\ufeff")
 
-		companyName := record[0]
+// trimBOM は入力ファイルの先頭の BOM を取り除く。
+// BOM が残っていると、1 行目の企業名が引用符で囲まれている場合に csv として読み込めなくなる。
+func trimBOM(src []byte) []byte {
+	return bytes.TrimPrefix(src, utf8BOM)
+}
 
-		if err := sem.Acquire(ctx, 1); err != nil {
-			log.Printf("Failed to acquire semaphore: %v", err)
-			return err
-		}
-		go func() {
-			defer sem.Release(1)
-			err = action(j, companyName)
-		}()
+// detectEncoding は入力ファイルのエンコーディングを判定する。
+// 判定に失敗した場合や対応していないエンコーディングの場合は、処理を止めずに UTF-8 として扱う。
+func detectEncoding(path string, src []byte) string {
+	r, err := chardet.NewTextDetector().DetectBest(src)
+	if err != nil {
+		logger.Printf("%s のエンコーディングを判定できなかったため UTF-8 として読み込みます (--input-encoding で指定できます): %v", path, err)
+		return "utf-8"
+	}
+	if e, _ := charset.Lookup(r.Charset); e == nil {
+		logger.Printf("%s のエンコーディング %s には対応していないため UTF-8 として読み込みます (--input-encoding で指定できます)", path, r.Charset)
+		return "utf-8"
+	}
+	return r.Charset
+}
+
+func parseDelimiter(value string) (rune, error) {
+	switch value {
+	case "\\t", "tab":
+		return '\t', nil
+	}
+	runes := []rune(value)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("区切り文字は 1 文字で指定してください: %q", value)
+	}
+	switch runes[0] {
+	case '\r', '\n', '"', utf8.RuneError:
+		return 0, fmt.Errorf("区切り文字として利用できない文字です: %q", value)
+	}
+	return runes[0], nil
+}
+
+// readFlagValue はフラグの値が "@" で始まる場合に、残りをファイルのパスとしてその内容を返す。
+// それ以外の場合は値をそのまま返す。
+func readFlagValue(value string) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	b, err := os.ReadFile(strings.TrimPrefix(value, "@"))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// invisibleReplacer は企業名に紛れ込みがちな不可視文字を取り除く
+var invisibleReplacer = strings.NewReplacer(
+	"\u200b", "", // ZERO WIDTH SPACE
+	"\u200c", "", // ZERO WIDTH NON-JOINER
+	"\u200d", "", // ZERO WIDTH JOINER
+	"\u2060", "", // WORD JOINER
+	"\ufeff", "", // BOM
+)
+
+// sanitizeCompanyName は CSV から読み込んだ企業名の前後の空白や引用符、不可視文字を取り除く。
+func sanitizeCompanyName(name string) string {
+	name = invisibleReplacer.Replace(name)
+	return strings.TrimFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"'“”‘’`, r)
+	})
+}
 
+// expandInputFiles は --input に指定された値のうちパターンを含むものを展開し、入力ファイルの一覧を返す。
+func expandInputFiles(inputs []string) ([]string, error) {
+	var files []string
+	for _, input := range inputs {
+		// URL の ? はクエリのためパターンとして扱わない
+		if isInputURL(input) || !strings.ContainsAny(input, "*?[") {
+			files = append(files, input)
+			continue
+		}
+		matches, err := filepath.Glob(input)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("入力ファイルのパターンが不正です: %s", input)
 		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("パターンに一致する入力ファイルが見つかりませんでした: %s", input)
+		}
+		files = append(files, matches...)
 	}
+	return files, nil
+}
 
-	return nil
+// panicError は企業ごとの処理中に発生したパニックを表す。
+type panicError struct {
+	value interface{}
+	// パニックを recover した時点の debug.Stack()
+	stack []byte
 }
 
-type ScrapeResult struct {
-	CompanyName, StockCode string
-	// 2013 ~ 2022
-	Price2013, Price2014, Price2015, Price2016, Price2017, Price2018, Price2019, Price2020, Price2021, Price2022 float64
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
 }
 
-func getStockCode(companyName string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("https://www.nikkei.com/nkd/search?searchKeyword=%s", url.QueryEscape(companyName)))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+// maxPanicStackLines は --error-output に書き出すスタックトレースの最大行数 (1 フレームで 2 行)
+const maxPanicStackLines = 20
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("日経のサイトでステータスコード %d が返りました", resp.StatusCode)
+// trimmedStack は --error-output に書き出すため、スタックトレースのうちパニックが発生した箇所からの
+// 最大 maxPanicStackLines 行を返す。recover や debug.Stack 自体のフレームは含めない。
+func (e *panicError) trimmedStack() string {
+	lines := strings.Split(strings.TrimSpace(string(e.stack)), "\n")
+	// 先頭の "goroutine N [running]:" と、runtime の panic までのフレームを読み飛ばす
+	start := 1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "panic(") {
+			start = i + 2
+			break
+		}
+	}
+	if start > len(lines) {
+		start = len(lines)
 	}
-	code := resp.Request.URL.Query().Get("scode")
-	if code != "" {
-		return code, nil
+	lines = lines[start:]
+	if len(lines) > maxPanicStackLines {
+		lines = append(lines[:maxPanicStackLines], "\t...")
 	}
+	return strings.Join(lines, "\n")
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return "", err
+// fetchExtras は株価とは別のページから配当や会社概要を取得して result に追加する。
+// 付加情報なので取得に失敗してもログに出力するだけにし、株価は出力する。
+func (s *Scraper) fetchExtras(ctx context.Context, companyName string, result *ScrapeResult, withDividends, withMetadata, withIndexMembership, withCurrentPrice bool) {
+	if result.StockCode == "" {
+		return
 	}
-	doc.Find(".m-companyList_item_data_name").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		if strings.TrimSpace(s.Text()) == companyName {
-			href, exists := s.Attr("href")
-			if exists {
-				value, err := url.ParseQuery(strings.Split(href, "?")[1])
-				if err != nil {
-					return false
-				}
-				code = value.Get("scode")
-			}
-			return false
+	if withDividends {
+		dividends, err := s.getDividends(ctx, result.StockCode)
+		if err != nil {
+			logger.Printf("%s の配当が取得できませんでした: %v", companyName, err)
 		}
-		return true
-	})
-
-	return code, nil
+		result.Dividends = dividends
+	}
+	if withMetadata || withIndexMembership {
+		metadata, err := s.getCompanyMetadata(ctx, result.StockCode)
+		if err != nil {
+			logger.Printf("%s の会社概要が取得できませんでした: %v", companyName, err)
+		}
+		if withMetadata {
+			result.Market, result.Industry = metadata.Market, metadata.Industry
+		}
+		if withIndexMembership {
+			result.Nikkei225, result.TOPIX = metadata.Nikkei225, metadata.TOPIX
+		}
+	}
+	if withCurrentPrice {
+		price, asOf, err := s.getCurrentPrice(ctx, result.StockCode)
+		if err != nil {
+			logger.Printf("%s の現在値が取得できませんでした: %v", companyName, err)
+		}
+		result.CurrentPrice, result.CurrentPriceAt = price, asOf
+	}
 }
 
-func searchPastStock(companyName string) (ScrapeResult, error) {
-	result := ScrapeResult{CompanyName: companyName}
-
-	code, err := getStockCode(companyName)
+// createOutputFile は出力ファイルを作成する。appendOutput が true の場合は既存のファイルの末尾に追記する。
+// 戻り値の writeHeader は、ファイルが空でヘッダ行を書き込む必要があるかどうかを表す。
+func createOutputFile(path string, appendOutput bool) (f *os.File, writeHeader bool, err error) {
+	if !appendOutput {
+		f, err = os.Create(path)
+		return f, true, err
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := f.Stat()
 	if err != nil {
-		return result, err
+		f.Close()
+		return nil, false, err
 	}
-	if code == "" {
-		log.Printf("該当する企業が見つかりませんでした: %s", companyName)
-		return result, nil
+	return f, info.Size() == 0, nil
+}
+
+// gzipFile は gzip で圧縮しながらファイルに書き込む。Close で圧縮を終えてからファイルを閉じる。
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
 	}
-	result.StockCode = code
+	return g.f.Close()
+}
 
-	// search https://www.nikkei.com/nkd/company/history/yprice/?scode=8304
-	resp, err := http.Get(fmt.Sprintf("https://www.nikkei.com/nkd/company/history/yprice?scode=%s", url.QueryEscape(code)))
+// createOutputWriter は createOutputFile で出力ファイルを作成し、gzipOutput が true の場合は gzip で圧縮して書き込む。
+// 追記の場合は新しい gzip のメンバーとして末尾に追加する (gzip -d などでそのまま展開できる)。
+func createOutputWriter(path string, appendOutput, gzipOutput bool) (io.WriteCloser, bool, error) {
+	f, writeHeader, err := createOutputFile(path, appendOutput)
 	if err != nil {
-		return result, err
+		return nil, false, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return result, fmt.Errorf("日経のサイトでステータスコード %d が返りました", resp.StatusCode)
+	if !gzipOutput {
+		return f, writeHeader, nil
 	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, writeHeader, nil
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return result, err
+// flushOutput は gzip などで出力ファイルの手前に溜まっているデータを書き出す。
+func flushOutput(out io.Writer) error {
+	if flusher, ok := out.(interface{ Flush() error }); ok {
+		return flusher.Flush()
 	}
+	return nil
+}
 
-	doc.Find(".m-headline").Each(func(_ int, s *goquery.Selection) {
-		if s.Find(".m-headline_text").Text() != "年間高安（過去10年）" {
-			return
+// readCsv は先頭の skipHeader 行を読み飛ばし、残りの各行を返す rowIterator を dispatch に渡す。
+// 各行の number はヘッダの次の行を 1 とする 1 始まりの番号 (ファイルでの行の位置 - skipHeader + 1) で、
+// skipHeader が 0 の場合は 1 行目がそのままデータとして 1 番で処理される。
+// fallbackColumn が 0 以上の場合は、その列 (0 始まり) の値を企業名で見つからなかった場合の検索に使う値にする。
+// rowIterator は src を読み込みながら順に行を返すため、大きなファイルでも行をすべてメモリに持たない。
+// comment が 0 でない場合は comment で始まる行をコメントとして読み飛ばす (--comment-char)。
+// この場合、コメントの行を数えても番号がずれないよう number はコメントの行も含めたファイルでの行の位置から求める。
+func readCsv(src io.Reader, delimiter, comment rune, skipHeader int, fallbackColumn int, dispatch func(next rowIterator) error) error {
+	return readCsvTo(logger, src, delimiter, comment, skipHeader, fallbackColumn, dispatch)
+}
+
+// readCsvTo は企業名の整形などの警告を log に出力する readCsv。
+func readCsvTo(log Logger, src io.Reader, delimiter, comment rune, skipHeader int, fallbackColumn int, dispatch func(next rowIterator) error) error {
+	r := csv.NewReader(src)
+	r.Comma = delimiter
+	r.Comment = comment
+	// 列数が行ごとに異なっていてもエラーにしない
+	r.FieldsPerRecord = -1
+	splitNames := &splitNameCheck{log: log, delimiter: delimiter}
+	for i := 0; i < skipHeader; i++ {
+		header, err := r.Read()
+		if err == io.EOF {
+			break
 		}
-		s.Next().Find("tr").Each(func(_ int, s *goquery.Selection) {
-			if s.Find("th").First().Text() == "年" {
-				return
+		if err != nil {
+			return err
+		}
+		splitNames.observeHeader(header)
+	}
+
+	j := skipHeader - 1
+	next := func() (inputRow, bool, error) {
+		for {
+			j++
+			record, err := r.Read()
+			if err == io.EOF {
+				return inputRow{}, false, nil
 			}
-			// 年を取得
-			year := strings.TrimSpace(s.Find("th").First().Text())
-			// 終値を取得
-			priceWithDate := strings.TrimSpace(s.Find("td:nth-child(5)").Text())
-			priceRaw := strings.ReplaceAll(strings.Split(priceWithDate, "(")[0], ",", "")
-			price, err := strconv.ParseFloat(priceRaw, 64)
 			if err != nil {
-				log.Printf("年 %s の終値が正しく取得できませんでした: %s", year, priceRaw)
-				return
+				return inputRow{}, false, err
+			}
+			if comment != 0 {
+				line, _ := r.FieldPos(0)
+				j = line - 1
 			}
 
-			switch year {
-			case "2013年":
-				result.Price2013 = price
-			case "2014年":
-				result.Price2014 = price
-			case "2015年":
-				result.Price2015 = price
-			case "2016年":
-				result.Price2016 = price
-			case "2017年":
-				result.Price2017 = price
-			case "2018年":
-				result.Price2018 = price
-			case "2019年":
-				result.Price2019 = price
-			case "2020年":
-				result.Price2020 = price
-			case "2021年":
-				result.Price2021 = price
-			case "2022年":
-				result.Price2022 = price
+			number := j - skipHeader + 1
+			splitNames.check(number, record)
+			companyName := sanitizeCompanyName(record[0])
+			if companyName != record[0] {
+				log.Printf("%d: 企業名を %q から %q に整形しました", number, record[0], companyName)
 			}
-		})
-	})
+			fallback := ""
+			if fallbackColumn >= 0 && fallbackColumn < len(record) {
+				fallback = sanitizeCompanyName(record[fallbackColumn])
+			}
+			if companyName == "" && fallback == "" {
+				log.Printf("%d: 企業名が空のため読み飛ばします", number)
+				continue
+			}
+			return inputRow{number: number, companyName: companyName, fallback: fallback}, true, nil
+		}
+	}
+	err := dispatch(next)
+	splitNames.summary()
+	return err
+}
 
-	return result, nil
+// inputRow は入力ファイルの 1 行分の企業名と検索に使う値
+type inputRow struct {
+	number                int
+	companyName, fallback string
 }
 
-var rootCmd = &cobra.Command{
-	Use:   "日本経済新聞 株価スクレイピングツール",
-	Short: "日本経済新聞のサイトから企業の過去の株価をスクレイピングする CLI です",
-	Long: `日本経済新聞のサイトから企業の過去の株価をスクレイピングする CLI です
+// inputReader は入力ファイルの内容を解釈し、各行を返す rowIterator を dispatch に渡す (readCsvTo、readJSON)。
+type inputReader func(src io.Reader, dispatch func(next rowIterator) error) error
 
-具体的な利用方法:
-  scrape-nikkei-past-price --input 1001人以上プライム.csv --output output.csv --concurrency 10
+// rowIterator は入力ファイルの次の行を返す。行が残っていない場合は ok に false を返す。
+type rowIterator func() (row inputRow, ok bool, err error)
 
-注意点:
-  - パフォーマンス向上のため、生成される csv ファイルは input ファイルと同じ順番で出力されません。
-    input ファイルでの列番号は index 列に保存してあるため、順番が重要な場合は適宜変更してください。`,
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// get flags
-		input, err := cmd.Flags().GetString("input")
-		if err != nil {
-			return err
+// sliceRows は rows を先頭から順に返す rowIterator を返す。
+func sliceRows(rows []inputRow) rowIterator {
+	return func() (inputRow, bool, error) {
+		if len(rows) == 0 {
+			return inputRow{}, false, nil
 		}
-		header, err := cmd.Flags().GetInt("header")
-		if err != nil {
-			return err
+		row := rows[0]
+		rows = rows[1:]
+		return row, true, nil
+	}
+}
+
+// dispatchRows は next が返す各行を sem で同時実行数を制限しながら action に渡す。
+// sem が nil の場合は goroutine を使わず、1 行ずつ順番に action を呼び出す (--concurrency 1)。
+// shuffle が nil でない場合は、すべての行を読み込んでから並べ替えた順番で渡す。
+func dispatchRows(ctx context.Context, sem *semaphore.Weighted, next rowIterator, shuffle *rand.Rand, action func(number int, name, fallback string) error) error {
+	if shuffle != nil {
+		var rows []inputRow
+		for {
+			row, ok, err := next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			rows = append(rows, row)
 		}
-		output, err := cmd.Flags().GetString("output")
-		if err != nil {
-			return err
+		shuffle.Shuffle(len(rows), func(a, b int) { rows[a], rows[b] = rows[b], rows[a] })
+		next = sliceRows(rows)
+	}
+	if sem == nil {
+		return dispatchRowsSequentially(ctx, next, action)
+	}
+
+	// 実行中の action がすべて終わるまで待ってから返る
+	var wg sync.WaitGroup
+
+	// action が返したエラー。エラーが発生したら新しい行の処理は始めず、
+	// 処理中だった行のエラーも含めてまとめて返す
+	var (
+		errMu sync.Mutex
+		errs  []rowError
+	)
+	// 中断された場合や行を読み込めなかった場合のエラー。それまでに失敗した行のエラーとまとめて返す
+	var stopErr error
+
+	for {
+		errMu.Lock()
+		failed := len(errs) > 0
+		errMu.Unlock()
+		if failed {
+			break
 		}
-		concurrency, err := cmd.Flags().GetInt64("concurrency")
+		// 中断された場合や実行時間の上限を過ぎた場合は新しい行の処理を始めない
+		if stopErr = ctx.Err(); stopErr != nil {
+			break
+		}
+		row, ok, err := next()
 		if err != nil {
-			return err
+			stopErr = err
+			break
+		}
+		if !ok {
+			break
 		}
 
-		// open input file
-		inputSrc, err := openInputFile(input)
-		if err != nil {
-			return err
+		if err := sem.Acquire(ctx, 1); err != nil {
+			logger.Printf("Failed to acquire semaphore: %v", err)
+			stopErr = err
+			break
+		}
+		// 空きを待っている間に他の行が失敗した場合も新しい行の処理は始めない
+		errMu.Lock()
+		failed = len(errs) > 0
+		errMu.Unlock()
+		if failed {
+			sem.Release(1)
+			break
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			if err := action(row.number, row.companyName, row.fallback); err != nil {
+				errMu.Lock()
+				errs = append(errs, rowError{row: row, err: err})
+				errMu.Unlock()
+			}
+		}()
+	}
 
-		// create output file
-		f, err := os.Create(output)
-		if err != nil {
+	wg.Wait()
+	return joinStopError(stopErr, errs)
+}
+
+// dispatchRowsSequentially は next が返す各行を、呼び出した goroutine で 1 行ずつ順番に action に渡す。
+// ログが企業ごとに順番に並び、エラーもその行を処理した直後に返るため、解析の問題を調べる際に追いやすい。
+func dispatchRowsSequentially(ctx context.Context, next rowIterator, action func(number int, name, fallback string) error) error {
+	for {
+		// 中断された場合や実行時間の上限を過ぎた場合は新しい行の処理を始めない
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		w := csv.NewWriter(f)
-		err = w.Write([]string{"企業名", "index", "コード", "2013", "2014", "2015", "2016", "2017", "2018", "2019", "2020", "2021", "2022"})
+		row, ok, err := next()
 		if err != nil {
 			return err
 		}
+		if !ok {
+			return nil
+		}
+		if err := action(row.number, row.companyName, row.fallback); err != nil {
+			// 処理中に中断された場合は、中断されたことも分かるようにする
+			return joinStopError(ctx.Err(), []rowError{{row: row, err: err}})
+		}
+	}
+}
 
-		sem := semaphore.NewWeighted(concurrency)
+// maxJoinedErrors は複数の行の処理に失敗した場合に、エラーのメッセージに含める行の数の上限
+const maxJoinedErrors = 10
 
-		// read csv
-		err = readCsv(sem, inputSrc, header, func(line int, companyName string) error {
-			log.Printf("%d: %s\n", line, companyName)
-			result, err := searchPastStock(companyName)
-			if err != nil {
-				return err
-			}
+// rowError は入力ファイルの 1 行の処理に失敗したエラー
+type rowError struct {
+	row inputRow
+	err error
+}
 
-			err = w.Write([]string{
-				companyName,
-				strconv.Itoa(line),
-				result.StockCode,
-				fmt.Sprintf("%.1f", result.Price2013),
-				fmt.Sprintf("%.1f", result.Price2014),
-				fmt.Sprintf("%.1f", result.Price2015),
-				fmt.Sprintf("%.1f", result.Price2016),
-				fmt.Sprintf("%.1f", result.Price2017),
-				fmt.Sprintf("%.1f", result.Price2018),
-				fmt.Sprintf("%.1f", result.Price2019),
-				fmt.Sprintf("%.1f", result.Price2020),
-				fmt.Sprintf("%.1f", result.Price2021),
-				fmt.Sprintf("%.1f", result.Price2022)})
+// rowErrors は複数の行の処理に失敗した場合に、それぞれのエラーをまとめたエラー
+type rowErrors []rowError
 
-			if err != nil {
-				return err
-			}
-			return nil
-		})
-		w.Flush()
+func (e rowErrors) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d 行の処理に失敗しました:", len(e))
+	for i, re := range e {
+		if i >= maxJoinedErrors {
+			fmt.Fprintf(&b, "\n  (ほか %d 行)", len(e)-maxJoinedErrors)
+			break
+		}
+		fmt.Fprintf(&b, "\n  - %d: %s: %v", re.row.number, re.row.companyName, re.err)
+	}
+	return b.String()
+}
 
-		if err != nil {
-			return err
+// Is はまとめたエラーのいずれかが target に該当するかどうかを返す。
+// go.mod の Go 1.19 の errors.Is は Unwrap() []error をたどらないため、Is で確認できるようにする。
+func (e rowErrors) Is(target error) bool {
+	for _, re := range e {
+		if errors.Is(re.err, target) {
+			return true
 		}
+	}
+	return false
+}
+
+// As はまとめたエラーのうち、最初に target に該当するエラーを target に設定する。
+func (e rowErrors) As(target interface{}) bool {
+	for _, re := range e {
+		if errors.As(re.err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap はまとめたエラーを返す。Go 1.20 以降の errors.Is や errors.As でもそれぞれのエラーを確認できる。
+func (e rowErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, re := range e {
+		errs[i] = re.err
+	}
+	return errs
+}
+
+// joinRowErrors は行ごとのエラーをまとめる。エラーが 1 つの場合はそのまま返し、無い場合は nil を返す。
+func joinRowErrors(errs []rowError) error {
+	switch len(errs) {
+	case 0:
 		return nil
-	},
+	case 1:
+		return errs[0].err
+	default:
+		// 処理が終わった順番ではなく入力ファイルの順番で表示する
+		sort.Slice(errs, func(a, b int) bool { return errs[a].row.number < errs[b].row.number })
+		return rowErrors(errs)
+	}
 }
 
-// Execute adds all child commands to the root command and sets flags appropriately.
-// This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+// interruptedError は中断された場合などに、それまでに失敗した行のエラーを中断の原因とまとめたエラー。
+// errors.Is や errors.As では中断の原因と行のエラーの両方を確認できる。
+type interruptedError struct {
+	cause error
+	rows  error
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("%v (中断する前に失敗した行: %v)", e.cause, e.rows)
+}
+
+func (e *interruptedError) Is(target error) bool {
+	return errors.Is(e.cause, target) || errors.Is(e.rows, target)
+}
+
+func (e *interruptedError) As(target interface{}) bool {
+	return errors.As(e.cause, target) || errors.As(e.rows, target)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.cause
+}
+
+// joinStopError は中断の原因 cause と、それまでに失敗した行のエラーをまとめる。
+// cause が nil の場合は行のエラーだけを、行のエラーが無い場合は cause をそのまま返す。
+func joinStopError(cause error, errs []rowError) error {
+	rows := joinRowErrors(errs)
+	switch {
+	case rows == nil:
+		return cause
+	case cause == nil || errors.Is(rows, cause):
+		// 行のエラーが中断によるものの場合は、行のエラーだけを返す
+		return rows
+	default:
+		return &interruptedError{cause: cause, rows: rows}
 	}
 }
 
-func init() {
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
+// 出力対象の年 (2013 ~ 2022)
+var targetYears = []int{2013, 2014, 2015, 2016, 2017, 2018, 2019, 2020, 2021, 2022}
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.scrape-nikkei-past-price.yaml)")
+type ScrapeResult struct {
+	CompanyName string `json:"company_name"`
+	StockCode   string `json:"stock_code"`
+	// 年ごとの終値
+	Prices map[int]float64 `json:"prices,omitempty"`
+	// 年ごとの始値
+	Opens map[int]float64 `json:"opens,omitempty"`
+	// 年ごとの終値のセルの解析前の文字列 (--with-raw-prices を指定した場合のみ)
+	RawPrices map[int]string `json:"raw_prices,omitempty"`
+	// 年ごとの出来高
+	Volumes map[int]float64 `json:"volumes,omitempty"`
+	// --fields で指定された見出しごとの、年ごとの値
+	Fields map[string]map[int]float64 `json:"fields,omitempty"`
+	// 株価が株式分割を調整したものかどうか。ページに注記が無い場合は nil
+	SplitAdjusted *bool `json:"split_adjusted,omitempty"`
+	// 終値が前年から大きく変化し、株式分割が調整されていない疑いのある年 (--split-warn-ratio)
+	SplitSuspectYears []int `json:"split_suspect_years,omitempty"`
+	// 年ごとの高値・安値を付けた日付 (ISO 8601。表に年・年月しか無い場合は "2022"・"2022-12")
+	HighDates map[int]string `json:"high_dates,omitempty"`
+	LowDates  map[int]string `json:"low_dates,omitempty"`
+	// 年ごとの 1 株あたり配当 (--with-dividends を指定した場合のみ)
+	Dividends map[int]float64 `json:"dividends,omitempty"`
+	// 年月 ("2022-01" の形式) ごとの終値 (--granularity month を指定した場合のみ)
+	MonthlyPrices map[string]float64 `json:"monthly_prices,omitempty"`
+	// 上場市場と業種 (--with-metadata を指定した場合のみ)
+	Market   string `json:"market,omitempty"`
+	Industry string `json:"industry,omitempty"`
+	// 日経平均・TOPIX の構成銘柄かどうか (--with-index-membership を指定した場合のみ)。ページに採用指数が無い場合は nil
+	Nikkei225 *bool `json:"nikkei225,omitempty"`
+	TOPIX     *bool `json:"topix,omitempty"`
+	// 取得時点の PER・PBR (倍) と時価総額 (百万円)。ページに無い場合は nil
+	PER       *float64 `json:"per,omitempty"`
+	PBR       *float64 `json:"pbr,omitempty"`
+	MarketCap *float64 `json:"market_cap,omitempty"`
+	// 企業ページに表示されている取得時点の現在値とその日時 (RFC 3339) (--with-current-price を指定した場合のみ)
+	CurrentPrice   *float64 `json:"current_price,omitempty"`
+	CurrentPriceAt string   `json:"current_price_at,omitempty"`
+	// 年間高安の表にある期間全体の高値・安値。表に期間全体の行が無い場合は nil
+	PeriodHigh *float64 `json:"period_high,omitempty"`
+	PeriodLow  *float64 `json:"period_low,omitempty"`
+	// 企業名を読み込んだ入力ファイルと、その中での行番号 (出力の index 列)
+	InputFile string `json:"input_file,omitempty"`
+	Index     int    `json:"-"`
+	// 株価を取得したページの URL と取得日時
+	SourceURL string    `json:"source_url,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
 
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().String("input", "", "入力用のcsvファイルのパスを指定してください")
-	rootCmd.MarkFlagFilename("input", "csv")
-	rootCmd.MarkFlagRequired("input")
+// FoundYears は出力対象の年のうち終値を取得できた年を昇順で返す。
+func (r ScrapeResult) FoundYears() []int {
+	var years []int
+	for _, year := range targetYears {
+		if _, ok := r.Prices[year]; ok {
+			years = append(years, year)
+		}
+	}
+	return years
+}
 
-	rootCmd.Flags().Int("header", 1, "ヘッダとして読み飛ばす行数を指定してください")
+// pricePlaceholderRunes は値が無いことを表すために表に表示される文字。
+// parsePrice は半角にそろえてから比べるため、"ー" を半角にした "ｰ" も含める
+const pricePlaceholderRunes = "-―ーｰ"
 
-	rootCmd.Flags().String("output", "", "出力用のcsvファイルのパスを指定してください")
-	rootCmd.MarkFlagRequired("output")
+// parsePrice は日経の表に表示される "¥1,234(12/30)" や "△12.5" のような価格の表記を数値に変換する。
+// "--" のように値が無いことを表す表記の場合は ok に false を返す。
+func parsePrice(text string) (price float64, ok bool, err error) {
+	// 全角の数字や記号は半角にそろえる
+	raw := width.Narrow.String(strings.Join(strings.Fields(text), ""))
+	if strings.Trim(raw, pricePlaceholderRunes) == "" {
+		return 0, false, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(raw, "(") && strings.HasSuffix(raw, ")") {
+		// (1,234) の形式の負数
+		negative = true
+		raw = raw[1 : len(raw)-1]
+	} else if i := strings.Index(raw, "("); i >= 0 {
+		// 1,234(12/30) のような末尾の日付は取り除く
+		raw = raw[:i]
+	}
+	for _, sign := range []string{"△", "▲", "-"} {
+		if strings.HasPrefix(raw, sign) {
+			negative = !negative
+			raw = strings.TrimPrefix(raw, sign)
+			break
+		}
+	}
+	raw = strings.TrimPrefix(raw, "¥")
+	raw = strings.TrimSuffix(raw, "円")
+	raw = strings.ReplaceAll(raw, ",", "")
+
+	price, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, &ParseError{Kind: "価格", Text: text}
+	}
+	if negative {
+		price = -price
+	}
+	return price, true, nil
+}
+
+// parseVolume は "1,234,500" や "1,234千株" のような出来高の表記を数値に変換する。
+// 価格と同様にカンマを取り除き、末尾の単位は無視する。
+func parseVolume(text string) (float64, error) {
+	raw := strings.ReplaceAll(strings.TrimSpace(text), ",", "")
+	raw = strings.TrimRightFunc(raw, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	volume, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, &ParseError{Kind: "出来高", Text: text}
+	}
+	return volume, nil
+}
+
+// ErrCompanyNotFound は日経のサイトの検索が成功し、該当する企業が無かったことを表す。
+// 通信の失敗などで結果が分からなかった場合とは区別する。
+var ErrCompanyNotFound = errors.New("該当する企業が見つかりませんでした")
+
+// ErrBlocked は日経のサイトから CAPTCHA やアクセス制限のページが返されたことを表す。
+var ErrBlocked = errors.New("日経のサイトからアクセスを制限するページが返されました。時間をおくか同時実行数を下げて再実行してください")
+
+// ErrHTTPStatus は日経のサイトから 200 以外のステータスコードが返ったことを表す。
+// ステータスコードは errors.As で *HTTPStatusError として取り出せる。
+var ErrHTTPStatus = errors.New("日経のサイトから 200 以外のステータスコードが返りました")
+
+// ErrParse は日経のページの内容を解釈できなかったことを表す。
+// 解釈できなかった値は errors.As で *ParseError として取り出せる。
+var ErrParse = errors.New("日経のページの内容を解釈できませんでした")
+
+// ParseError はページ内の値を解釈できなかったことを表す。errors.Is(err, ErrParse) が true になる。
+type ParseError struct {
+	// Kind は解釈しようとした値の種類 (価格、出来高、年など)
+	Kind string
+	// Text は解釈できなかった文字列
+	Text string
+	// Err は元になったエラー (無い場合は nil)
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	message := fmt.Sprintf("%sとして解釈できませんでした: %q", e.Kind, e.Text)
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// blockPageMarkers はアクセス制限や CAPTCHA のページに含まれる文言
+var blockPageMarkers = []string{
+	"captcha",
+	"access denied",
+	"request blocked",
+	"too many requests",
+	"アクセスが集中",
+	"アクセスを制限",
+	"ロボットではありません",
+}
+
+// isBlockPage は取得したページがアクセス制限や CAPTCHA のページかどうかを判定する。
+func isBlockPage(doc *goquery.Document) bool {
+	if doc.Find(".g-recaptcha, #challenge-form, iframe[src*='captcha']").Length() > 0 {
+		return true
+	}
+	title := strings.ToLower(doc.Find("title").Text())
+	for _, marker := range blockPageMarkers {
+		if strings.Contains(title, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusSnippetLength はステータスコードのエラーに含めるレスポンス本文の最大文字数
+const statusSnippetLength = 200
+
+// HTTPStatusError は日経のサイトから 200 以外のステータスコードが返ったことを表す。
+// errors.Is(err, ErrHTTPStatus) が true になる。
+type HTTPStatusError struct {
+	StatusCode int
+	message    string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return e.message
+}
+
+func (e *HTTPStatusError) Is(target error) bool {
+	return target == ErrHTTPStatus
+}
+
+// statusError は 200 以外のステータスコードが返った場合のエラーを作る。
+// メンテナンス中のページやアクセス制限と区別できるよう、ページのタイトルや本文の先頭、一部のヘッダを含める。
+func statusError(resp *http.Response) error {
+	message := fmt.Sprintf("日経のサイトでステータスコード %d が返りました", resp.StatusCode)
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		message += fmt.Sprintf(" (Retry-After: %s)", retryAfter)
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	snippet := ""
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		snippet = strings.TrimSpace(doc.Find("title").Text() + " " + doc.Find("body").Text())
+	}
+	snippet = strings.Join(strings.Fields(snippet), " ")
+	if runes := []rune(snippet); len(runes) > statusSnippetLength {
+		snippet = string(runes[:statusSnippetLength]) + "..."
+	}
+	if snippet != "" {
+		message += ": " + snippet
+	}
+	return &HTTPStatusError{StatusCode: resp.StatusCode, message: message}
+}
+
+// httpClient は日経のサイトへのリクエストに使う HTTP クライアント
+var httpClient = &http.Client{}
+
+// noRedirectClient はリダイレクトを自動で追わない HTTP クライアント。
+// 検索結果のリダイレクト先を Scraper.LookupCode で明示的に確認するために使う。
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+const (
+	// defaultMaxIdleConnsPerHost は nikkei.com への接続を使い回すために保持しておく接続数の既定値。
+	// net/http の既定値 (2) では同時実行数が多いときに接続の作り直しが頻発する。
+	defaultMaxIdleConnsPerHost = 16
+	// idleConnTimeout は使われていない接続を閉じるまでの時間
+	idleConnTimeout = 90 * time.Second
+)
+
+// cancelOnClose はレスポンスの本文を閉じた時に、取得に使ったコンテキストをキャンセルする。
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// defaultMaxResponseBytes はレスポンスの本文として読み込むバイト数の上限 (--max-request-bytes) の既定値
+const defaultMaxResponseBytes = 10 << 20
+
+// limitedBody は本文を limit バイトまでしか読み込まず、超えた場合はそれ以降の読み込みを常にエラーにする。
+// io.LimitReader と異なり、上限で途切れた本文を正常に読み終えたものとして扱わないようにする。
+type limitedBody struct {
+	io.ReadCloser
+	limit, read int64
+	err         error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// 上限を超えたかどうかを判定するため、上限より 1 バイトだけ多く読み込む
+	if remaining := b.limit - b.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.err = fmt.Errorf("レスポンスの本文が --max-request-bytes (%d バイト) を超えました", b.limit)
+		return n - int(b.read-b.limit), b.err
+	}
+	return n, err
+}
+
+// limitBody は MaxResponseBytes が指定されている場合に resp の本文を limitedBody で包む。
+func (s *Scraper) limitBody(resp *http.Response) *http.Response {
+	if s.MaxResponseBytes > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, limit: s.MaxResponseBytes}
+	}
+	return resp
+}
+
+// httpGet は reqCtx をキャンセルすると中断される GET リクエストを client で送る。
+// RequestTimeout が指定されている場合は、取得を試みるごとに本文を読み終えるまでの時間を制限する。
+// classifyRetry でリトライの対象とされた失敗は、種類ごとの上限 (retryLimit) まで Backoff の間隔を空けてリトライする。
+// hostLimits が設定されている場合は、リクエストを送ってから応答のヘッダを受け取るまでホストごとの枠を確保する。
+func (s *Scraper) httpGet(reqCtx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	if s.cache != nil {
+		if resp, ok := s.cache.get(reqCtx, client, rawURL); ok {
+			if s.Verbose {
+				s.logf("GET %s (キャッシュ)", rawURL)
+			}
+			return s.limitBody(resp), nil
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		var (
+			attemptCtx context.Context
+			cancel     context.CancelFunc
+		)
+		if s.RequestTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(reqCtx, s.RequestTimeout)
+		} else {
+			attemptCtx, cancel = context.WithCancel(reqCtx)
+		}
+		req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		release := func() {}
+		if s.hostLimits != nil {
+			release, err = s.hostLimits.acquire(attemptCtx, req.URL.Host)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		release()
+		// レスポンスのヘッダを受け取るまでの時間
+		d := time.Since(start)
+		if s.Verbose {
+			s.logf("GET %s (%s)", rawURL, d.Round(time.Millisecond))
+			s.timings.record(requestKind(rawURL), d)
+		}
+		if s.metrics != nil {
+			s.metrics.observe(metricsPage(requestKind(rawURL)), d)
+		}
+		if err != nil && reqCtx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("--per-request-timeout (%s) 以内に応答がありませんでした: %w", s.RequestTimeout, err)
+		}
+
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
+			if s.adaptive != nil {
+				s.adaptive.observe(s.log(), statusCode)
+			}
+		}
+
+		// 呼び出し元がキャンセルした場合や --max-runtime を過ぎた場合はリトライしない
+		kind := retryNone
+		if reqCtx.Err() == nil {
+			kind = classifyRetry(err, statusCode)
+		}
+		if kind == retryNone || attempt >= s.retryLimit(kind) || !s.takeRetry() {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			// 上限を超えた本文をキャッシュに保存する時点で読み込み続けないよう、先に上限を設ける
+			s.limitBody(resp)
+			if s.cache != nil && cacheableStatus(resp.StatusCode) {
+				if err := s.cache.put(client, rawURL, resp); err != nil {
+					s.logf("レスポンスをキャッシュに保存できませんでした: %s: %v", rawURL, err)
+				}
+			}
+			return resp, nil
+		}
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("ステータスコード %d", resp.StatusCode)
+			resp.Body.Close()
+		}
+		cancel()
+		delay := s.Backoff.delay(attempt)
+		// 個々のリトライは --verbose の場合のみ出力する (合計回数は実行の終わりに出力する)
+		if s.Verbose {
+			subject := requestSubject(rawURL)
+			logFieldsTo(s.log(), "info", logFields{Company: subject, URL: rawURL}, "%s: %d/%d 回目の取得に失敗したため %s 後にリトライします: %s (%s)", subject, attempt+1, s.retryLimit(kind)+1, delay.Round(time.Millisecond), reason, rawURL)
+		}
+		if !sleepContext(reqCtx, delay) {
+			return nil, reqCtx.Err()
+		}
+	}
+}
+
+// configureHTTPClient は httpClient と noRedirectClient が使う Transport を設定する。
+// proxyURLs が空の場合は環境変数 HTTP_PROXY / HTTPS_PROXY の設定に従い、複数の場合はリクエストごとに順番に使う。
+// 日経のサイトへの接続を使い回せるよう、ホストごとに maxIdleConnsPerHost 個までの接続を保持する。
+func configureHTTPClient(proxyURLs []string, maxIdleConnsPerHost int) error {
+	if maxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("--max-idle-conns-per-host には 1 以上の値を指定してください: %d", maxIdleConnsPerHost)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if transport.MaxIdleConns < maxIdleConnsPerHost {
+		transport.MaxIdleConns = maxIdleConnsPerHost
+	}
+	transport.IdleConnTimeout = idleConnTimeout
+	proxies := make([]*url.URL, len(proxyURLs))
+	for i, proxyURL := range proxyURLs {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		proxies[i] = u
+	}
+	switch len(proxies) {
+	case 0:
+		httpClient.Transport = transport
+	case 1:
+		transport.Proxy = http.ProxyURL(proxies[0])
+		httpClient.Transport = transport
+	default:
+		proxyPool = newRotatingProxies(transport, proxies)
+		httpClient.Transport = proxyPool
+	}
+	noRedirectClient.Transport = httpClient.Transport
+	return nil
+}
+
+// normalizeStockCode は日経のサイトから取得したコードの表記を揃える。
+// 2024 年以降の上場銘柄には "130A" のように英字を含むコードがあるため、数字のみとは仮定せず、
+// 全角を半角に、英字を大文字に揃えるだけにする。
+func normalizeStockCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(width.Narrow.String(code)))
+}
+
+// stockCodePattern は正規化したコードの形式 ("7203" や "130A" のような 4 文字)
+var stockCodePattern = regexp.MustCompile(`^[0-9][0-9A-Z]{3}$`)
+
+// ErrInvalidStockCode は --no-search の場合に入力ファイルのコードが無いか不正であることを表す。
+var ErrInvalidStockCode = errors.New("入力ファイルのコードが無いか不正です")
+
+// parseSearchParams は --search-param に指定された key=value の一覧を解釈する。
+func parseSearchParams(values []string) (url.Values, error) {
+	params := url.Values{}
+	for _, value := range values {
+		key, v, found := strings.Cut(value, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("--search-param は key=value の形式で指定してください: %s", value)
+		}
+		if key == "searchKeyword" {
+			return nil, fmt.Errorf("--search-param に searchKeyword は指定できません")
+		}
+		params.Add(key, v)
+	}
+	return params, nil
+}
+
+const (
+	// 年ごとの株価 (年間高安) を取得する
+	granularityYear = "year"
+	// 月ごとの株価 (月間高安) を取得する
+	granularityMonth = "month"
+)
+
+// valuationUnits は時価総額の単位ごとの百万円への換算倍率
+var valuationUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"百万円", 1},
+	{"億円", 100},
+	{"兆円", 1000000},
+}
+
+// parseValuationValue は "12.3倍" や "1,234,567百万円" のような値を数値に変換する。
+// 時価総額は百万円単位に揃える。解釈できない場合は nil を返す。
+func parseValuationValue(text string) *float64 {
+	text = strings.TrimSpace(width.Narrow.String(text))
+	scale := 1.0
+	for _, unit := range valuationUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSuffix(text, unit.suffix)
+			scale = unit.scale
+			break
+		}
+	}
+	text = strings.TrimSuffix(text, "倍")
+	value, ok, err := parsePrice(text)
+	if err != nil || !ok {
+		return nil
+	}
+	value *= scale
+	return &value
+}
+
+// parseValuation は株価のページにある PER・PBR・時価総額を取得する。
+// ページの構成によって見出しが異なるため、候補の見出しを順に探し、見つからない項目は nil のままにする。
+func parseValuation(doc *goquery.Document, result *ScrapeResult) {
+	find := func(labels ...string) *float64 {
+		for _, label := range labels {
+			if value := findLabeledValue(doc, label); value != "" {
+				return parseValuationValue(value)
+			}
+		}
+		return nil
+	}
+	result.PER = find("予想PER", "PER")
+	result.PBR = find("実績PBR", "PBR")
+	result.MarketCap = find("時価総額")
+}
+
+// yearLabelPattern は "2013年"、"2013"、"2013 年"、"2013年度" のような年の表記にマッチする
+var yearLabelPattern = regexp.MustCompile(`^(\d{4})\s*(?:年度?)?$`)
+
+// parseYear は年間高安の表の年の列を整数に変換する。
+// ページによって "年" が無かったり全角数字だったりするため、幅を揃えてから解釈する。
+func parseYear(text string) (int, error) {
+	text = strings.TrimSpace(width.Narrow.String(text))
+	m := yearLabelPattern.FindStringSubmatch(text)
+	if m == nil {
+		return 0, &ParseError{Kind: "年", Text: text}
+	}
+	return strconv.Atoi(m[1])
+}
+
+// checkZeroPrices は ZeroIsError の場合に、終値が 0 の年があれば ParseError を返す。
+// 実際に取引されている企業の終値が 0 になることは無いため、表の列がずれたことを検知するために使う。
+func (s *Scraper) checkZeroPrices(result ScrapeResult) error {
+	if !s.ZeroIsError {
+		return nil
+	}
+	var years []string
+	for _, year := range targetYears {
+		if price, ok := result.Prices[year]; ok && price == 0 {
+			years = append(years, strconv.Itoa(year))
+		}
+	}
+	if len(years) == 0 {
+		return nil
+	}
+	return &ParseError{Kind: "終値", Text: "0", Err: fmt.Errorf("%s 年の終値が 0 です (--zero-is-error)", strings.Join(years, ", "))}
+}
+
+// periodSummaryLabels は年間高安の表で期間全体の高値・安値を表す行の見出しに含まれる文言
+var periodSummaryLabels = []string{"期間", "過去10年", "10年間"}
+
+// isPeriodSummaryLabel は年間高安の表の見出しが期間全体の行のものかどうかを返す。
+func isPeriodSummaryLabel(text string) bool {
+	for _, label := range periodSummaryLabels {
+		if strings.Contains(text, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultHistorySection は年ごとの株価を取得する表の見出し
+const defaultHistorySection = "年間高安（過去10年）"
+
+// normalizeHeadline は見出しの比較のため、全角・半角と空白の違いを揃える。
+func normalizeHeadline(text string) string {
+	return strings.Join(strings.Fields(width.Fold.String(text)), "")
+}
+
+// findHistoryTable は見出しに HistorySection を含む表を返す。見つからない場合は
+// defaultHistorySection の表を使い、それも無い場合は nil を返す。
+// 見出しの文言が少し変わっただけで結果が空にならないよう、完全一致ではなく含むかどうかで判定する。
+func (s *Scraper) findHistoryTable(doc *goquery.Document) *goquery.Selection {
+	sections := []string{defaultHistorySection}
+	if s.HistorySection != "" && s.HistorySection != defaultHistorySection {
+		sections = []string{s.HistorySection, defaultHistorySection}
+	}
+	headlines := doc.Find(".m-headline")
+	for i, section := range sections {
+		want := normalizeHeadline(section)
+		// 対象の表は 1 つだけなので、最初に見つかった見出しの表を使う
+		headline := headlines.FilterFunction(func(_ int, h *goquery.Selection) bool {
+			return strings.Contains(normalizeHeadline(h.Find(".m-headline_text").Text()), want)
+		}).First()
+		if headline.Length() == 0 {
+			continue
+		}
+		if i > 0 {
+			s.logf("見出しに %q を含む表が見つからなかったため %q の表から取得します", sections[0], section)
+		}
+		return headline.Next()
+	}
+	return nil
+}
+
+// parseYearlyPrices は HistorySection (既定では「年間高安（過去10年）」) の表から年ごとの終値と出来高を取得する。
+// 表に期間全体の高値・安値の行がある場合は PeriodHigh・PeriodLow に取得する。
+func (s *Scraper) parseYearlyPrices(doc *goquery.Document, result *ScrapeResult) {
+	table := s.findHistoryTable(doc)
+	if table == nil {
+		return
+	}
+	cols := findPriceColumns(table)
+	var fieldCols map[string]int
+	if len(s.Fields) > 0 {
+		fieldCols = findFieldColumns(table, s.Fields)
+		result.Fields = map[string]map[int]float64{}
+	}
+	// 解析に失敗したセルの内容 (--debug-dump 用)
+	var problems []string
+	table.Find("tr").Each(func(_ int, row *goquery.Selection) {
+		// 行ごとにセレクタを解釈し直さないよう、子要素を 1 度だけ取得して位置で参照する
+		cells := row.Children()
+		// 年を取得
+		yearText := strings.TrimSpace(cells.First().Text())
+		if yearText == "年" {
+			return
+		}
+		if isPeriodSummaryLabel(yearText) {
+			// 期間全体の行は無い場合もあるため、取得できなかった値は nil のままにする
+			period := func(raw string) *float64 {
+				value, ok, err := parsePrice(raw)
+				if err != nil {
+					s.logf("%s の高値・安値が正しく取得できませんでした: %v", yearText, err)
+					problems = append(problems, fmt.Sprintf("%s: %q", yearText, raw))
+					return nil
+				}
+				if !ok {
+					return nil
+				}
+				return &value
+			}
+			result.PeriodHigh = period(cells.Eq(cols.high).Text())
+			result.PeriodLow = period(cells.Eq(cols.low).Text())
+			return
+		}
+		year, err := parseYear(yearText)
+		if err != nil {
+			s.logf("年が正しく取得できませんでした: %s", yearText)
+			problems = append(problems, fmt.Sprintf("年: %q", yearText))
+			return
+		}
+		// 終値を取得
+		priceRaw := cells.Eq(cols.close).Text()
+		price, ok, err := parsePrice(priceRaw)
+		switch {
+		case err != nil:
+			s.logf("年 %s の終値が正しく取得できませんでした: %v", yearText, err)
+			problems = append(problems, fmt.Sprintf("%s の終値: %q", yearText, priceRaw))
+		case ok:
+			result.Prices[year] = price
+		}
+		// 始値を取得 (値が無い年は Opens に含めない)
+		openRaw := cells.Eq(cols.open).Text()
+		open, ok, err := parsePrice(openRaw)
+		switch {
+		case err != nil:
+			s.logf("年 %s の始値が正しく取得できませんでした: %v", yearText, err)
+			problems = append(problems, fmt.Sprintf("%s の始値: %q", yearText, openRaw))
+		case ok:
+			result.Opens[year] = open
+		}
+		if s.KeepRawPrices {
+			if result.RawPrices == nil {
+				result.RawPrices = map[int]string{}
+			}
+			result.RawPrices[year] = strings.TrimSpace(priceRaw)
+		}
+		recordPriceDates(cells, cols, year, result)
+
+		// --fields で指定された列の値を取得
+		for _, name := range s.Fields {
+			i, found := fieldCols[name]
+			if !found {
+				continue
+			}
+			raw := cells.Eq(i).Text()
+			value, ok, err := parseFieldValue(name, raw)
+			switch {
+			case err != nil:
+				s.logf("年 %s の %s が正しく取得できませんでした: %v", yearText, name, err)
+				problems = append(problems, fmt.Sprintf("%s の %s: %q", yearText, name, raw))
+			case ok:
+				if result.Fields[name] == nil {
+					result.Fields[name] = map[int]float64{}
+				}
+				result.Fields[name][year] = value
+			}
+		}
+
+		// 出来高を取得
+		volumeRaw := strings.TrimSpace(cells.Eq(cols.volume).Text())
+		volume, err := parseVolume(volumeRaw)
+		if err != nil {
+			s.logf("年 %s の出来高が正しく取得できませんでした: %s", yearText, volumeRaw)
+			problems = append(problems, fmt.Sprintf("%s の出来高: %q", yearText, volumeRaw))
+			return
+		}
+		result.Volumes[year] = volume
+	})
+	if debugDumpDir != "" && len(problems) > 0 {
+		tableHTML := ""
+		if debugDumpHTML {
+			tableHTML, _ = goquery.OuterHtml(table)
+		}
+		if err := writeDebugDump(result.StockCode, problems, tableHTML); err != nil {
+			s.logf("%v", err)
+		}
+	}
+}
+
+// priceColumns は株価の表で各値が何列目 (0 始まり) にあるかを表す。
+type priceColumns struct {
+	open, high, low, close, volume int
+}
+
+// defaultPriceColumns は見出しの行が見つからない場合の列の位置 (年, 始値, 高値, 安値, 終値, 出来高 の順)
+var defaultPriceColumns = priceColumns{open: 1, high: 2, low: 3, close: 4, volume: 5}
+
+// priceColumnsWarn は列の位置が変わっていることを 1 度だけログに出力するために使う
+var priceColumnsWarn sync.Once
+
+// findPriceColumns は株価の表の見出しの行から各値の列の位置を求める。
+// 日経のサイトで列が追加されても値がずれないよう、位置を決め打ちせずに見出しの文言で探す。
+// 見出しの行が無い場合や見つからない見出しは defaultPriceColumns の位置を使う。
+func findPriceColumns(table *goquery.Selection) priceColumns {
+	cols := defaultPriceColumns
+	table.Find("tr").EachWithBreak(func(_ int, row *goquery.Selection) bool {
+		headers := row.Children()
+		found := false
+		headers.Each(func(i int, cell *goquery.Selection) {
+			if strings.Contains(normalizeHeadline(cell.Text()), "終値") {
+				found = true
+			}
+		})
+		if !found {
+			return true
+		}
+		headers.Each(func(i int, cell *goquery.Selection) {
+			text := normalizeHeadline(cell.Text())
+			switch {
+			case strings.Contains(text, "始値"):
+				cols.open = i
+			case strings.Contains(text, "高値"):
+				cols.high = i
+			case strings.Contains(text, "安値"):
+				cols.low = i
+			case strings.Contains(text, "終値"):
+				cols.close = i
+			case strings.Contains(text, "出来高"):
+				cols.volume = i
+			}
+		})
+		if cols != defaultPriceColumns {
+			priceColumnsWarn.Do(func() {
+				logger.Printf("株価の表の列の位置が変わっています (始値: %d, 高値: %d, 安値: %d, 終値: %d, 出来高: %d 列目)", cols.open+1, cols.high+1, cols.low+1, cols.close+1, cols.volume+1)
+			})
+		}
+		return false
+	})
+	return cols
+}
+
+// yearMonthPattern は "2022年1月" や "2022/01" のような年月の表記にマッチする
+var yearMonthPattern = regexp.MustCompile(`^(\d{4})\D+(\d{1,2})`)
+
+// parseMonthlyPrices は月間高安の表から年月ごとの終値を取得する。
+// 年月は "2022-01" の形式で MonthlyPrices に格納する。
+func parseMonthlyPrices(doc *goquery.Document, result *ScrapeResult) {
+	doc.Find("table").Each(func(_ int, table *goquery.Selection) {
+		cols := findPriceColumns(table)
+		table.Find("tr").Each(func(_ int, s *goquery.Selection) {
+			label := strings.TrimSpace(s.Find("th").First().Text())
+			m := yearMonthPattern.FindStringSubmatch(width.Narrow.String(label))
+			if m == nil {
+				return
+			}
+			month, _ := strconv.Atoi(m[2])
+			if month < 1 || month > 12 {
+				return
+			}
+			// 終値を取得
+			price, ok, err := parsePrice(s.Children().Eq(cols.close).Text())
+			switch {
+			case err != nil:
+				logger.Printf("%s の終値が正しく取得できませんでした: %v", label, err)
+			case ok:
+				result.MonthlyPrices[fmt.Sprintf("%s-%02d", m[1], month)] = price
+			}
+		})
+	})
+}
+
+// findLabeledValue は th や dt の見出しが label に一致する項目の値を返す。見つからなければ空文字を返す。
+func findLabeledValue(doc *goquery.Document, label string) string {
+	value := ""
+	doc.Find("th, dt").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if strings.TrimSpace(s.Text()) != label {
+			return true
+		}
+		value = strings.Join(strings.Fields(s.NextFiltered("td, dd").Text()), " ")
+		return false
+	})
+	return value
+}
+
+// companyMetadata は企業の会社概要ページから取得する付加情報
+type companyMetadata struct {
+	Market, Industry string
+	// 日経平均・TOPIX の構成銘柄かどうか。ページに採用指数の項目が無い場合は nil
+	Nikkei225, TOPIX *bool
+}
+
+// indexMembershipLabels は会社概要ページで採用されている指数を表す項目の見出し
+var indexMembershipLabels = []string{"採用指数", "指数採用", "主な採用指数"}
+
+// parseIndexMembership は会社概要ページの採用指数の項目から日経平均・TOPIX の構成銘柄かどうかを判定する。
+// 項目が無い場合は nil を返す。
+func parseIndexMembership(doc *goquery.Document) (nikkei225, topix *bool) {
+	for _, label := range indexMembershipLabels {
+		value := width.Fold.String(findLabeledValue(doc, label))
+		if value == "" {
+			continue
+		}
+		inNikkei225 := strings.Contains(value, "日経平均") || strings.Contains(value, "日経225")
+		inTOPIX := strings.Contains(strings.ToUpper(value), "TOPIX")
+		return &inNikkei225, &inTOPIX
+	}
+	return nil, nil
+}
+
+// getCompanyMetadata は企業の会社概要ページから上場市場・業種と採用指数を取得する。
+// 該当する項目がページに無い場合は空文字や nil にする。
+func (s *Scraper) getCompanyMetadata(ctx context.Context, code string) (companyMetadata, error) {
+	defer s.waitMinDelay(ctx)
+	companyURL := fmt.Sprintf("%s/nkd/company/gaiyou/?scode=%s", s.BaseURL, url.QueryEscape(code))
+	if err := s.checkRobots(companyURL); err != nil {
+		return companyMetadata{}, err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, companyURL)
+	if err != nil {
+		return companyMetadata{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return companyMetadata{}, statusError(resp)
+	}
+
+	doc, err := parseDocument(resp, code+"_gaiyou")
+	if err != nil {
+		return companyMetadata{}, err
+	}
+	metadata := companyMetadata{Market: findLabeledValue(doc, "上場市場"), Industry: findLabeledValue(doc, "業種")}
+	metadata.Nikkei225, metadata.TOPIX = parseIndexMembership(doc)
+	return metadata, nil
+}
+
+// fiscalYearPattern は "2022年3月期" や "2022/3" のような決算期の表記から年を取り出す
+var fiscalYearPattern = regexp.MustCompile(`(\d{4})`)
+
+// getDividends は企業の決算ページから年ごとの 1 株あたり配当を取得する。
+// 配当が掲載されていない年は結果に含めない。
+func (s *Scraper) getDividends(ctx context.Context, code string) (map[int]float64, error) {
+	defer s.waitMinDelay(ctx)
+	kessanURL := fmt.Sprintf("%s/nkd/company/kessan/?scode=%s", s.BaseURL, url.QueryEscape(code))
+	if err := s.checkRobots(kessanURL); err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, kessanURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, statusError(resp)
+	}
+
+	doc, err := parseDocument(resp, code+"_kessan")
+	if err != nil {
+		return nil, err
+	}
+	if isBlockPage(doc) {
+		return nil, ErrBlocked
+	}
+
+	dividends := map[int]float64{}
+	doc.Find("table").Each(func(_ int, table *goquery.Selection) {
+		// 見出し行の各列から決算期の年を取得する
+		var years []int
+		table.Find("tr").First().Children().Each(func(i int, s *goquery.Selection) {
+			if i == 0 {
+				return
+			}
+			year := 0
+			if m := fiscalYearPattern.FindString(width.Narrow.String(s.Text())); m != "" {
+				year, _ = strconv.Atoi(m)
+			}
+			years = append(years, year)
+		})
+
+		table.Find("tr").Each(func(_ int, row *goquery.Selection) {
+			if !strings.Contains(row.Children().First().Text(), "配当") {
+				return
+			}
+			row.Children().Each(func(i int, s *goquery.Selection) {
+				if i == 0 || i > len(years) || years[i-1] == 0 {
+					return
+				}
+				dividend, ok, err := parsePrice(s.Text())
+				if err != nil || !ok {
+					return
+				}
+				dividends[years[i-1]] = dividend
+			})
+		})
+	})
+	return dividends, nil
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "日本経済新聞 株価スクレイピングツール",
+	Short: "日本経済新聞のサイトから企業の過去の株価をスクレイピングする CLI です",
+	Long: `日本経済新聞のサイトから企業の過去の株価をスクレイピングする CLI です
+
+具体的な利用方法:
+  scrape-nikkei-past-price --input 1001人以上プライム.csv --output output.csv --concurrency 10
+
+注意点:
+  - パフォーマンス向上のため、生成される csv ファイルは input ファイルと同じ順番で出力されません。
+    input ファイルでの列番号は index 列に保存してあるため、順番が重要な場合は適宜変更してください。`,
+	PersistentPreRunE: checkConfig,
+	// Uncomment the following line if your bare application
+	// has an action associated with it:
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		printConfigOnly, err := cmd.Flags().GetBool("print-config")
+		if err != nil {
+			return err
+		}
+		if printConfigOnly {
+			// 値の確認に使うため、内容に誤りがあってもそのまま表示する
+			printConfig(cmd.ErrOrStderr(), cmd.Flags())
+			return nil
+		}
+
+		// スクレイピングを始める前に指定された内容をすべて確認し、誤りをまとめて報告する
+		var problems validationErrors
+		// リクエストや解析の設定はフラグから 1 つの Scraper にまとめ、すべての企業の処理で使う
+		scraper := NewScraper()
+
+		// get flags
+		inputs, err := cmd.Flags().GetStringArray("input")
+		if err != nil {
+			return err
+		}
+		inputFiles, err := expandInputFiles(inputs)
+		if err != nil {
+			problems.add(err)
+		}
+		for _, inputFile := range inputFiles {
+			if isInputURL(inputFile) {
+				continue
+			}
+			if err := checkReadable(inputFile); err != nil {
+				problems.add(err)
+			}
+		}
+		multipleInputs := len(inputFiles) > 1
+		header, err := cmd.Flags().GetInt("header")
+		if err != nil {
+			return err
+		}
+		if header < 0 {
+			problems.addf("--header には 0 以上の値を指定してください: %d", header)
+		}
+		fallbackColumn, err := cmd.Flags().GetInt("fallback-column")
+		if err != nil {
+			return err
+		}
+		if fallbackColumn < 0 || fallbackColumn == 1 {
+			problems.addf("--fallback-column には 2 以上の列番号を指定してください (0 の場合は利用しません): %d", fallbackColumn)
+		}
+		inputDelimiter, err := cmd.Flags().GetString("input-delimiter")
+		if err != nil {
+			return err
+		}
+		delimiter, err := parseDelimiter(inputDelimiter)
+		if err != nil {
+			problems.add(err)
+		}
+		commentChar, err := cmd.Flags().GetString("comment-char")
+		if err != nil {
+			return err
+		}
+		var comment rune
+		if commentChar != "" {
+			if comment, err = parseDelimiter(commentChar); err != nil {
+				problems.addf("--comment-char には 1 文字を指定してください: %q", commentChar)
+			} else if comment == delimiter {
+				problems.addf("--comment-char には --input-delimiter と異なる文字を指定してください: %q", commentChar)
+			}
+		}
+		inputEncoding, err := cmd.Flags().GetString("input-encoding")
+		if err != nil {
+			return err
+		}
+		streamInput, err := cmd.Flags().GetBool("stream-input")
+		if err != nil {
+			return err
+		}
+		if streamInput {
+			for _, inputFile := range inputFiles {
+				if isInputURL(inputFile) {
+					problems.addf("--stream-input は URL の入力ファイルには利用できません: %s", inputFile)
+				}
+			}
+		}
+		inputFormat, err := cmd.Flags().GetString("input-format")
+		if err != nil {
+			return err
+		}
+		noSearch, err := cmd.Flags().GetBool("no-search")
+		if err != nil {
+			return err
+		}
+		codeColumn, err := cmd.Flags().GetInt("code-column")
+		if err != nil {
+			return err
+		}
+		if codeColumn < 0 || codeColumn == 1 {
+			problems.addf("--code-column には 2 以上の列番号を指定してください (0 の場合は利用しません): %d", codeColumn)
+		}
+		if noSearch && inputFormat == inputFormatCSV && codeColumn == 0 {
+			problems.addf("--no-search を指定する場合は --code-column でコードの列を指定してください")
+		}
+		if codeColumn != 0 && !noSearch {
+			problems.addf("--code-column は --no-search と組み合わせて指定してください")
+		}
+		if noSearch && fallbackColumn != 0 {
+			problems.addf("--no-search の場合は --fallback-column ではなく --code-column でコードの列を指定してください")
+		}
+		switch inputFormat {
+		case inputFormatCSV:
+		case inputFormatJSON:
+			// JSON の場合は csv 向けのオプションは使わない
+			for _, name := range []string{"header", "fallback-column", "code-column", "input-delimiter", "comment-char", "input-encoding", "stream-input"} {
+				if changedOnCommandLine(cmd.Flags(), name) {
+					problems.addf("--input-format json の場合は --%s は指定できません", name)
+				}
+			}
+		default:
+			problems.addf("--input-format には csv または json を指定してください: %s", inputFormat)
+		}
+		if inputEncoding != "" {
+			if e, _ := charset.Lookup(inputEncoding); e == nil {
+				problems.addf("--input-encoding に対応していないエンコーディングが指定されました: %s", inputEncoding)
+			}
+		}
+		sample, err := cmd.Flags().GetInt("sample")
+		if err != nil {
+			return err
+		}
+		if sample < 0 {
+			problems.addf("--sample には 0 以上の値を指定してください: %d", sample)
+		}
+		shuffleInput, err := cmd.Flags().GetBool("shuffle-input")
+		if err != nil {
+			return err
+		}
+		seed, err := cmd.Flags().GetInt64("seed")
+		if err != nil {
+			return err
+		}
+		outputs, err := cmd.Flags().GetStringArray("output")
+		if err != nil {
+			return err
+		}
+		concurrency, err := cmd.Flags().GetInt64("concurrency")
+		if err != nil {
+			return err
+		}
+		if concurrency <= 0 {
+			problems.addf("--concurrency には 1 以上の値を指定してください: %d", concurrency)
+		}
+		rampUp, err := cmd.Flags().GetDuration("ramp-up")
+		if err != nil {
+			return err
+		}
+		if rampUp < 0 {
+			problems.addf("--ramp-up には 0 以上の値を指定してください: %s", rampUp)
+		}
+		ramp := &workerRamp{duration: rampUp, workers: concurrency}
+		workersPerHost, err := cmd.Flags().GetInt64("workers-per-host")
+		if err != nil {
+			return err
+		}
+		switch {
+		case workersPerHost < 0:
+			problems.addf("--workers-per-host には 0 以上の値を指定してください: %d", workersPerHost)
+		case workersPerHost == 0:
+			// 未指定の場合は全体の同時実行数と同じにする
+			workersPerHost = concurrency
+		}
+		if workersPerHost > 0 {
+			scraper.hostLimits = newHostLimiter(workersPerHost)
+		}
+		errorOutput, err := cmd.Flags().GetString("error-output")
+		if err != nil {
+			return err
+		}
+		reportPath, err := cmd.Flags().GetString("report")
+		if err != nil {
+			return err
+		}
+		notFoundOutput, err := cmd.Flags().GetString("notfound-output")
+		if err != nil {
+			return err
+		}
+		metricsFile, err := cmd.Flags().GetString("metrics-file")
+		if err != nil {
+			return err
+		}
+		saveCodesPath, err := cmd.Flags().GetString("save-codes")
+		if err != nil {
+			return err
+		}
+		lockfile, err := cmd.Flags().GetString("lockfile")
+		if err != nil {
+			return err
+		}
+		lockWait, err := cmd.Flags().GetDuration("lock-wait")
+		if err != nil {
+			return err
+		}
+		if lockWait < 0 {
+			problems.addf("--lock-wait には 0 以上の値を指定してください: %s", lockWait)
+		}
+		appendOutput, err := cmd.Flags().GetBool("append")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		gzipOutput, err := cmd.Flags().GetBool("gzip")
+		if err != nil {
+			return err
+		}
+		targets, err := parseOutputs(outputs, format, changedOnCommandLine(cmd.Flags(), "format"), gzipOutput)
+		if err != nil {
+			problems.add(err)
+		}
+		for _, target := range targets {
+			if target.format == "json" && appendOutput {
+				problems.addf("--format json の場合は --append を利用できません (追記する場合は --format ndjson を利用してください): %s", target.path)
+			}
+			if target.format == "xlsx" && appendOutput {
+				problems.addf("--format xlsx の場合は --append を利用できません: %s", target.path)
+			}
+		}
+		pretty, err := cmd.Flags().GetBool("pretty")
+		if err != nil {
+			return err
+		}
+		noHeader, err := cmd.Flags().GetBool("no-header")
+		if err != nil {
+			return err
+		}
+		alwaysQuote, err := cmd.Flags().GetBool("always-quote")
+		if err != nil {
+			return err
+		}
+		mkdir, err := cmd.Flags().GetBool("mkdir")
+		if err != nil {
+			return err
+		}
+		outputPaths := []string{errorOutput, reportPath, notFoundOutput, metricsFile, saveCodesPath}
+		for _, target := range targets {
+			outputPaths = append(outputPaths, target.path)
+		}
+		for _, path := range outputPaths {
+			if path == "" {
+				continue
+			}
+			if mkdir {
+				if err := makeOutputDir(path); err != nil {
+					problems.add(err)
+					continue
+				}
+			}
+			if err := checkWritable(path); err != nil {
+				problems.add(err)
+			}
+		}
+		granularity, err := cmd.Flags().GetString("granularity")
+		if err != nil {
+			return err
+		}
+		if granularity != granularityYear && granularity != granularityMonth {
+			problems.addf("--granularity には year または month を指定してください: %s", granularity)
+		}
+		for _, target := range targets {
+			if granularity == granularityMonth && target.format == "sqlite" {
+				problems.addf("--granularity month は --format sqlite と同時に指定できません: %s", target.path)
+			}
+		}
+		long, err := cmd.Flags().GetBool("long")
+		if err != nil {
+			return err
+		}
+		columns, err := cmd.Flags().GetString("columns")
+		if err != nil {
+			return err
+		}
+		headerTemplate, err := cmd.Flags().GetString("header-template")
+		if err != nil {
+			return err
+		}
+		lang, err := cmd.Flags().GetString("lang")
+		if err != nil {
+			return err
+		}
+		if lang != "ja" && lang != "en" {
+			problems.addf("--lang には ja または en を指定してください: %s", lang)
+		}
+		precision, err := cmd.Flags().GetInt("precision")
+		if err != nil {
+			return err
+		}
+		if precision < 0 {
+			problems.addf("--precision には 0 以上の値を指定してください: %d", precision)
+		}
+		integerPrices, err := cmd.Flags().GetBool("integer-prices")
+		if err != nil {
+			return err
+		}
+		withVolume, err := cmd.Flags().GetBool("with-volume")
+		if err != nil {
+			return err
+		}
+		withOpen, err := cmd.Flags().GetBool("with-open")
+		if err != nil {
+			return err
+		}
+		if withOpen && granularity == granularityMonth {
+			problems.addf("--with-open は --granularity month の場合は利用できません")
+		}
+		withDividends, err := cmd.Flags().GetBool("with-dividends")
+		if err != nil {
+			return err
+		}
+		withMetadata, err := cmd.Flags().GetBool("with-metadata")
+		if err != nil {
+			return err
+		}
+		withIndexMembership, err := cmd.Flags().GetBool("with-index-membership")
+		if err != nil {
+			return err
+		}
+		scraper.HistorySection, err = cmd.Flags().GetString("history-section")
+		if err != nil {
+			return err
+		}
+		scraper.ZeroIsError, err = cmd.Flags().GetBool("zero-is-error")
+		if err != nil {
+			return err
+		}
+		scraper.KeepRawPrices, err = cmd.Flags().GetBool("with-raw-prices")
+		if err != nil {
+			return err
+		}
+		if scraper.KeepRawPrices && granularity == granularityMonth {
+			problems.addf("--with-raw-prices は --granularity month の場合は利用できません")
+		}
+		withPeriodRange, err := cmd.Flags().GetBool("with-period-range")
+		if err != nil {
+			return err
+		}
+		if withPeriodRange && granularity == granularityMonth {
+			problems.addf("--with-period-range は --granularity month の場合は利用できません")
+		}
+		fields, err := cmd.Flags().GetString("fields")
+		if err != nil {
+			return err
+		}
+		if fields != "" {
+			if scraper.Fields, err = parseFields(fields); err != nil {
+				problems.add(err)
+			}
+			if granularity == granularityMonth {
+				problems.addf("--fields は --granularity month の場合は利用できません")
+			}
+		}
+		splitWarnRatio, err = cmd.Flags().GetFloat64("split-warn-ratio")
+		if err != nil {
+			return err
+		}
+		if err := validateSplitWarnRatio(splitWarnRatio); err != nil {
+			problems.add(err)
+		}
+		datesAsColumns, err := cmd.Flags().GetBool("dates-as-columns")
+		if err != nil {
+			return err
+		}
+		if datesAsColumns && granularity == granularityMonth {
+			problems.addf("--dates-as-columns は --granularity month の場合は利用できません")
+		}
+		withSplitCheck, err := cmd.Flags().GetBool("with-split-check")
+		if err != nil {
+			return err
+		}
+		if withSplitCheck && granularity == granularityMonth {
+			problems.addf("--with-split-check は --granularity month の場合は利用できません")
+		}
+		requireComplete, err := cmd.Flags().GetBool("require-complete")
+		if err != nil {
+			return err
+		}
+		if requireComplete && granularity == granularityMonth {
+			problems.addf("--require-complete は --granularity month の場合は利用できません")
+		}
+		minPriceValues, err := cmd.Flags().GetStringArray("min-price")
+		if err != nil {
+			return err
+		}
+		minPrices, err = parseMinPrices(minPriceValues)
+		if err != nil {
+			problems.add(err)
+		}
+		if len(minPrices) > 0 && granularity == granularityMonth {
+			problems.addf("--min-price は --granularity month の場合は利用できません")
+		}
+		withValuation, err := cmd.Flags().GetBool("with-valuation")
+		if err != nil {
+			return err
+		}
+		withCurrentPrice, err := cmd.Flags().GetBool("with-current-price")
+		if err != nil {
+			return err
+		}
+		withFoundYears, err := cmd.Flags().GetBool("with-found-years")
+		if err != nil {
+			return err
+		}
+		withYearsFound, err := cmd.Flags().GetBool("with-years-found")
+		if err != nil {
+			return err
+		}
+		withQualityScore, err := cmd.Flags().GetBool("with-quality-score")
+		if err != nil {
+			return err
+		}
+		if withQualityScore && granularity == granularityMonth {
+			problems.addf("--with-quality-score は --granularity month の場合は利用できません")
+		}
+		withProvenance, err := cmd.Flags().GetBool("with-provenance")
+		if err != nil {
+			return err
+		}
+		fallbackSourceSpec, err := cmd.Flags().GetString("fallback-source")
+		if err != nil {
+			return err
+		}
+		var secondarySource PriceSource
+		if fallbackSourceSpec != "" {
+			if secondarySource, err = newPriceSource(fallbackSourceSpec); err != nil {
+				problems.add(err)
+			}
+		}
+		noHistory, err := cmd.Flags().GetBool("no-history")
+		if err != nil {
+			return err
+		}
+		if noHistory {
+			// 株価のページから取得する値は --no-history の場合は空になるため、同時に指定できないようにする
+			conflicts := []struct {
+				flag string
+				set  bool
+			}{
+				{"--long", long},
+				{"--granularity month", granularity == granularityMonth},
+				{"--with-volume", withVolume},
+				{"--with-open", withOpen},
+				{"--with-period-range", withPeriodRange},
+				{"--with-valuation", withValuation},
+				{"--with-found-years", withFoundYears},
+				{"--with-years-found", withYearsFound},
+				{"--with-quality-score", withQualityScore},
+				{"--with-split-check", withSplitCheck},
+				{"--dates-as-columns", datesAsColumns},
+				{"--with-raw-prices", scraper.KeepRawPrices},
+				{"--fields", len(scraper.Fields) > 0},
+				{"--require-complete", requireComplete},
+				{"--min-price", len(minPrices) > 0},
+			}
+			for _, conflict := range conflicts {
+				if conflict.set {
+					problems.addf("--no-history は %s と同時に指定できません", conflict.flag)
+				}
+			}
+		}
+		logFormat, err := cmd.Flags().GetString("log-format")
+		if err != nil {
+			return err
+		}
+		err = setLogFormat(logFormat)
+		if err != nil {
+			problems.add(err)
+		}
+		proxies, err := cmd.Flags().GetStringArray("proxy")
+		if err != nil {
+			return err
+		}
+		proxyList, err := cmd.Flags().GetString("proxy-list")
+		if err != nil {
+			return err
+		}
+		if proxyList != "" {
+			listed, err := readProxyList(proxyList)
+			if err != nil {
+				problems.add(err)
+			}
+			proxies = append(proxies, listed...)
+		}
+		proxyCooldown, err = cmd.Flags().GetDuration("proxy-cooldown")
+		if err != nil {
+			return err
+		}
+		if proxyCooldown < 0 {
+			problems.addf("--proxy-cooldown には 0 以上の値を指定してください: %s", proxyCooldown)
+		}
+		maxIdleConnsPerHost, err := cmd.Flags().GetInt("max-idle-conns-per-host")
+		if err != nil {
+			return err
+		}
+		err = configureHTTPClient(proxies, maxIdleConnsPerHost)
+		if err != nil {
+			problems.add(err)
+		}
+		cassettePath, err := cmd.Flags().GetString("cassette")
+		if err != nil {
+			return err
+		}
+		cassetteMode, err := cmd.Flags().GetString("cassette-mode")
+		if err != nil {
+			return err
+		}
+		var recorder *Cassette
+		if cassettePath != "" {
+			recorder, err = OpenCassette(cassettePath, cassetteMode, httpClient.Transport)
+			if err != nil {
+				problems.add(err)
+			} else {
+				httpClient.Transport = recorder
+				noRedirectClient.Transport = recorder
+			}
+		}
+		httpCacheDir, err := cmd.Flags().GetString("http-cache-dir")
+		if err != nil {
+			return err
+		}
+		httpCacheTTL, err := cmd.Flags().GetDuration("http-cache-ttl")
+		if err != nil {
+			return err
+		}
+		if httpCacheDir != "" {
+			scraper.cache, err = newResponseCache(httpCacheDir, httpCacheTTL)
+			if err != nil {
+				problems.add(err)
+			}
+		}
+		respectRobots, err := cmd.Flags().GetBool("respect-robots")
+		if err != nil {
+			return err
+		}
+		warmupEnabled, err := cmd.Flags().GetBool("warmup")
+		if err != nil {
+			return err
+		}
+		robotsForce, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+		searchParamValues, err := cmd.Flags().GetStringArray("search-param")
+		if err != nil {
+			return err
+		}
+		searchParams, err := parseSearchParams(searchParamValues)
+		if err != nil {
+			problems.add(err)
+		}
+		scraper.TimeoutRetries, err = cmd.Flags().GetInt("timeout-retries")
+		if err != nil {
+			return err
+		}
+		if scraper.TimeoutRetries < -1 {
+			problems.addf("--timeout-retries には 0 以上の値 (-1 の場合は --retries と同じ) を指定してください: %d", scraper.TimeoutRetries)
+		}
+		scraper.RetryBudget, err = cmd.Flags().GetInt64("retry-budget")
+		if err != nil {
+			return err
+		}
+		if scraper.RetryBudget < 0 {
+			problems.addf("--retry-budget には 0 以上の値を指定してください: %d", scraper.RetryBudget)
+		}
+		scraper.Retries, err = cmd.Flags().GetInt("retries")
+		if err != nil {
+			return err
+		}
+		if scraper.Retries < 0 {
+			problems.addf("--retries には 0 以上の値を指定してください: %d", scraper.Retries)
+		}
+		retryEmpty, err := cmd.Flags().GetInt("retry-empty")
+		if err != nil {
+			return err
+		}
+		if retryEmpty < 0 {
+			problems.addf("--retry-empty には 0 以上の値を指定してください: %d", retryEmpty)
+		}
+		normalizeSuffix, err := cmd.Flags().GetBool("normalize-company-suffix")
+		if err != nil {
+			return err
+		}
+		scraper.Backoff.Base, err = cmd.Flags().GetDuration("backoff-base")
+		if err != nil {
+			return err
+		}
+		scraper.Backoff.Multiplier, err = cmd.Flags().GetFloat64("backoff-multiplier")
+		if err != nil {
+			return err
+		}
+		scraper.Backoff.Max, err = cmd.Flags().GetDuration("backoff-max")
+		if err != nil {
+			return err
+		}
+		scraper.Backoff.Jitter, err = cmd.Flags().GetBool("backoff-jitter")
+		if err != nil {
+			return err
+		}
+		if err := scraper.Backoff.validate(); err != nil {
+			problems.add(err)
+		}
+		includeCodesValue, err := cmd.Flags().GetString("include-codes")
+		if err != nil {
+			return err
+		}
+		includeCodes, err = parseCodeList(includeCodesValue)
+		if err != nil {
+			problems.addf("--include-codes を読み込めませんでした: %v", err)
+		}
+		excludeCodesValue, err := cmd.Flags().GetString("exclude-codes")
+		if err != nil {
+			return err
+		}
+		excludeCodes, err = parseCodeList(excludeCodesValue)
+		if err != nil {
+			problems.addf("--exclude-codes を読み込めませんでした: %v", err)
+		}
+		preview, err := cmd.Flags().GetInt("preview")
+		if err != nil {
+			return err
+		}
+		if preview < 0 {
+			problems.addf("--preview には 0 以上の値を指定してください: %d", preview)
+		}
+		interactive, err = cmd.Flags().GetBool("interactive")
+		if err != nil {
+			return err
+		}
+		scraper.Verbose, err = cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return err
+		}
+		scraper.MinDelay, err = cmd.Flags().GetDuration("min-delay")
+		if err != nil {
+			return err
+		}
+		if scraper.MinDelay < 0 {
+			problems.addf("--min-delay には 0 以上の値を指定してください: %s", scraper.MinDelay)
+		}
+		adaptiveDelayEnabled, err := cmd.Flags().GetBool("adaptive-delay")
+		if err != nil {
+			return err
+		}
+		maxDelay, err := cmd.Flags().GetDuration("max-delay")
+		if err != nil {
+			return err
+		}
+		if maxDelay < scraper.MinDelay {
+			problems.addf("--max-delay には --min-delay (%s) 以上の値を指定してください: %s", scraper.MinDelay, maxDelay)
+		}
+		if adaptiveDelayEnabled {
+			scraper.adaptive = newAdaptiveDelay(scraper.MinDelay, maxDelay)
+		}
+		if workersPerHost > 0 {
+			if message := concurrencyWarning(concurrency, workersPerHost, scraper.MinDelay); message != "" {
+				logger.Printf("%s", message)
+			}
+		}
+		continueOnError, err := cmd.Flags().GetBool("continue-on-error")
+		if err != nil {
+			return err
+		}
+		failFastThreshold, err := cmd.Flags().GetInt("fail-fast-threshold")
+		if err != nil {
+			return err
+		}
+		if failFastThreshold < 0 {
+			problems.addf("--fail-fast-threshold には 0 以上の値を指定してください: %d", failFastThreshold)
+		}
+		flushEvery, err := cmd.Flags().GetInt("flush-every")
+		if err != nil {
+			return err
+		}
+		flushInterval, err := cmd.Flags().GetDuration("flush-interval")
+		if err != nil {
+			return err
+		}
+		maxRows, err := cmd.Flags().GetInt("max-rows")
+		if err != nil {
+			return err
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		debugDumpDir, err = cmd.Flags().GetString("debug-dump")
+		if err != nil {
+			return err
+		}
+		debugDumpHTML, err = cmd.Flags().GetBool("debug-dump-html")
+		if err != nil {
+			return err
+		}
+		if debugDumpHTML && debugDumpDir == "" {
+			problems.addf("--debug-dump-html は --debug-dump と同時に指定してください")
+		}
+		maxNotFoundRatio, err := cmd.Flags().GetFloat64("max-not-found-ratio")
+		if err != nil {
+			return err
+		}
+		if maxNotFoundRatio < 0 || maxNotFoundRatio > 1 {
+			problems.addf("--max-not-found-ratio には 0 以上 1 以下の値を指定してください: %g", maxNotFoundRatio)
+		}
+		scraper.RequestTimeout, err = cmd.Flags().GetDuration("per-request-timeout")
+		if err != nil {
+			return err
+		}
+		if scraper.RequestTimeout < 0 {
+			problems.addf("--per-request-timeout には 0 以上の値を指定してください: %s", scraper.RequestTimeout)
+		}
+		scraper.MaxResponseBytes, err = cmd.Flags().GetInt64("max-request-bytes")
+		if err != nil {
+			return err
+		}
+		if scraper.MaxResponseBytes < 0 {
+			problems.addf("--max-request-bytes には 0 以上の値を指定してください: %d", scraper.MaxResponseBytes)
+		}
+		maxRuntime, err := cmd.Flags().GetDuration("max-runtime")
+		if err != nil {
+			return err
+		}
+		if maxRuntime < 0 {
+			problems.addf("--max-runtime には 0 以上の値を指定してください: %s", maxRuntime)
+		}
+		deadlinePerFile, err := cmd.Flags().GetDuration("deadline-per-file")
+		if err != nil {
+			return err
+		}
+		if deadlinePerFile < 0 {
+			problems.addf("--deadline-per-file には 0 以上の値を指定してください: %s", deadlinePerFile)
+		}
+		if flushEvery < 0 {
+			problems.addf("--flush-every には 0 以上の値を指定してください: %d", flushEvery)
+		}
+		if maxRows < 0 {
+			problems.addf("--max-rows には 0 以上の値を指定してください: %d", maxRows)
+		}
+		years, err := cmd.Flags().GetString("years")
+		if err != nil {
+			return err
+		}
+		var outputYears []int
+		if years != "" {
+			outputYears, err = parseYears(years)
+			if err != nil {
+				problems.add(err)
+			}
+			if granularity == granularityMonth {
+				problems.addf("--years は --granularity month と同時に指定できません")
+			}
+		}
+		transpose, err := cmd.Flags().GetBool("transpose")
+		if err != nil {
+			return err
+		}
+		if transpose {
+			if long || granularity == granularityMonth {
+				problems.addf("--transpose は --long や --granularity month と同時に指定できません")
+			}
+			if appendOutput {
+				problems.addf("--transpose の場合は --append を利用できません")
+			}
+			for _, target := range targets {
+				if target.format != "csv" {
+					problems.addf("--transpose は --format csv の場合のみ利用できます: %s", target.path)
+				}
+			}
+		}
+		if flushInterval < 0 {
+			problems.addf("--flush-interval には 0 以上の値を指定してください: %s", flushInterval)
+		}
+		var outputColumns []string
+		if columns != "" {
+			outputColumns, err = parseColumns("--columns", columns, long, granularity == granularityMonth)
+			if err != nil {
+				problems.add(err)
+			}
+		}
+		appendIndex, err := cmd.Flags().GetBool("output-append-index")
+		if err != nil {
+			return err
+		}
+		if changedOnCommandLine(cmd.Flags(), "output-append-index") && (columns != "" || headerTemplate != "") {
+			problems.addf("--output-append-index は --columns や --header-template と同時に指定できません (出力する列は --columns などで指定してください)")
+		}
+		codeFirst, err := cmd.Flags().GetBool("code-first")
+		if err != nil {
+			return err
+		}
+		if codeFirst && (columns != "" || headerTemplate != "") {
+			problems.addf("--code-first は --columns や --header-template と同時に指定できません (出力する列は --columns などで指定してください)")
+		}
+		var headerNames map[string]string
+		if headerTemplate != "" {
+			if columns != "" {
+				problems.addf("--header-template と --columns は同時に指定できません")
+			} else if outputColumns, headerNames, err = parseHeaderTemplate(headerTemplate, long, granularity == granularityMonth); err != nil {
+				problems.add(err)
+			}
+		}
+		sheetBy, err := cmd.Flags().GetString("sheet-by")
+		if err != nil {
+			return err
+		}
+		if sheetBy != "" {
+			if err := validateSheetBy(sheetBy, outputOptions{Long: long, Monthly: granularity == granularityMonth, Lang: lang}); err != nil {
+				problems.add(err)
+			}
+			hasXlsx := false
+			for _, target := range targets {
+				hasXlsx = hasXlsx || target.format == "xlsx"
+			}
+			if !hasXlsx {
+				problems.addf("--sheet-by は --format xlsx の出力ファイルがある場合のみ利用できます")
+			}
+		}
+		if err := problems.err(); err != nil {
+			return err
+		}
+		if recorder != nil {
+			// 途中で中断した場合も、それまでに記録したレスポンスを書き出す
+			defer func() {
+				if saveErr := recorder.Save(); saveErr != nil && err == nil {
+					err = saveErr
+				}
+			}()
+		}
+
+		// Ctrl+C などで中断された場合は新しい企業の処理を始めず、それまでの結果を書き出して終了する
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// 定期実行が重ならないよう、他の実行が終わっていない場合は何も書き出さずに終了する
+		if lockfile != "" {
+			unlock, err := acquireLock(ctx, lockfile, lockWait)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+
+		if debugDumpDir != "" {
+			if err := os.MkdirAll(debugDumpDir, 0777); err != nil {
+				return fmt.Errorf("--debug-dump のディレクトリを作成できませんでした: %w", err)
+			}
+		}
+
+		// 途中で中断した場合もどこまで処理できたか分かるよう、終了時に必ず集計結果を書き出す
+		report := newRunReport(cmd.Flags())
+		if reportPath != "" {
+			defer func() {
+				if reportErr := report.write(reportPath, scraper.totalRetries(), err); reportErr != nil {
+					logger.Printf("実行結果の集計を書き出せませんでした: %v", reportErr)
+				}
+			}()
+		}
+		if metricsFile != "" {
+			scraper.metrics = newRequestHistogram()
+			defer func() {
+				if metricsErr := writeMetrics(metricsFile, report, scraper.metrics, scraper.totalRetries(), err); metricsErr != nil {
+					logger.Printf("メトリクスを書き出せませんでした: %v", metricsErr)
+				}
+			}()
+		}
+
+		// 見つからなかった企業も、途中で中断した場合にそれまでの分を書き出す
+		var notFound notFoundRows
+		if notFoundOutput != "" {
+			defer func() {
+				if writeErr := notFound.write(notFoundOutput, lang, multipleInputs); writeErr != nil && err == nil {
+					err = writeErr
+				}
+			}()
+		}
+		// 検索して分かったコードも、途中で中断した場合にそれまでの分を書き出す
+		var resolvedCodes savedCodes
+		if saveCodesPath != "" {
+			defer func() {
+				if writeErr := resolvedCodes.write(saveCodesPath); writeErr != nil && err == nil {
+					err = writeErr
+				}
+			}()
+		}
+		fileIndex := make(map[string]int, len(inputFiles))
+		for i, inputFile := range inputFiles {
+			fileIndex[inputFile] = i
+		}
+
+		if maxRuntime > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, maxRuntime)
+			defer cancel()
+		}
+
+		if respectRobots {
+			rules, err := scraper.loadRobots(ctx)
+			if err != nil {
+				return fmt.Errorf("robots.txt を取得できませんでした: %w", err)
+			}
+			rules.force = robotsForce
+			scraper.robots = rules
+		}
+		if warmupEnabled {
+			// セッションが無くても取得できるページが多いため、失敗しても処理は続ける
+			if err := scraper.warmup(ctx); err != nil {
+				logger.Printf("ウォームアップに失敗したため Cookie 無しで続けます: %v", err)
+			}
+		}
+
+		// open input files
+		inputSrcs := make([]inputSource, len(inputFiles))
+		for i, inputFile := range inputFiles {
+			// URL の入力ファイルも 1 ページ分の取得として --per-request-timeout で時間を制限する
+			readCtx, cancelRead := ctx, context.CancelFunc(func() {})
+			if isInputURL(inputFile) && scraper.RequestTimeout > 0 {
+				readCtx, cancelRead = context.WithTimeout(ctx, scraper.RequestTimeout)
+			}
+			switch {
+			case inputFormat == inputFormatJSON:
+				// JSON は UTF-8 で書かれているため、エンコーディングの判定は行わない
+				var src []byte
+				src, err = readInputFile(readCtx, inputFile)
+				inputSrcs[i] = inputSource{path: inputFile, data: trimBOM(src)}
+			case streamInput:
+				inputSrcs[i], err = streamInputSource(inputFile, inputEncoding)
+			default:
+				inputSrcs[i], err = loadInputSource(readCtx, inputFile, inputEncoding)
+			}
+			cancelRead()
+			if err != nil {
+				return err
+			}
+		}
+		// --no-search の場合は --code-column のコードを fallback として読み込む
+		column := fallbackColumn
+		if noSearch {
+			column = codeColumn
+		}
+		newInputReader := func(log Logger) inputReader {
+			if inputFormat == inputFormatJSON {
+				return func(src io.Reader, dispatch func(next rowIterator) error) error {
+					return readJSON(log, src, dispatch)
+				}
+			}
+			return func(src io.Reader, dispatch func(next rowIterator) error) error {
+				return readCsvTo(log, src, delimiter, comment, header, column-1, dispatch)
+			}
+		}
+		readInput := newInputReader(logger)
+		// --sample や --max-rows で行を数えるだけの読み込みでは、警告を実際の処理で 1 度だけ出力するよう出力しない
+		countInput := newInputReader(discardLogger{})
+
+		// create output file
+		scraper.SearchParams = searchParams
+		scraper.Granularity = granularity
+		scraper.NoSearch = noSearch
+		scraper.Interactive = interactive
+		scraper.NoHistory = noHistory
+		scraper.RetryEmpty = retryEmpty
+		scraper.NormalizeSuffix = normalizeSuffix
+		var source PriceSource = scraper
+		if secondarySource != nil {
+			source = fallbackSource{primary: scraper, secondary: secondarySource}
+		}
+
+		outputOpts := outputOptions{
+			Long:                long,
+			Monthly:             granularity == granularityMonth,
+			WithVolume:          withVolume,
+			WithOpen:            withOpen,
+			WithDividends:       withDividends,
+			WithMetadata:        withMetadata,
+			WithIndexMembership: withIndexMembership,
+			WithValuation:       withValuation,
+			WithCurrentPrice:    withCurrentPrice,
+			WithPeriodRange:     withPeriodRange,
+			WithFoundYears:      withFoundYears,
+			WithYearsFound:      withYearsFound,
+			WithQualityScore:    withQualityScore,
+			WithProvenance:      withProvenance,
+			WithInputFile:       multipleInputs,
+			WithoutIndex:        !appendIndex,
+			CodeFirst:           codeFirst,
+			Precision:           precision,
+			IntegerPrices:       integerPrices,
+			Lang:                lang,
+			Columns:             outputColumns,
+			HeaderNames:         headerNames,
+			Pretty:              pretty,
+			Fields:              scraper.Fields,
+			WithSplitCheck:      withSplitCheck,
+			WithPriceDates:      datesAsColumns,
+			WithRawPrices:       scraper.KeepRawPrices,
+			WithoutHistory:      noHistory,
+			WithoutHeader:       noHeader,
+			AlwaysQuote:         alwaysQuote,
+			SheetBy:             sheetBy,
+			Years:               outputYears,
+			Transpose:           transpose,
+			TransposeLimit:      maxRows,
+		}
+		notFoundValue, err := cmd.Flags().GetString("notfound-value")
+		if err != nil {
+			return err
+		}
+		// 設定ファイルにデフォルト値 (空) が書かれているだけの場合 (--print-config の出力など) は指定されていないものとする
+		if changedOnCommandLine(cmd.Flags(), "notfound-value") || (configFlags["notfound-value"] && notFoundValue != "") {
+			outputOpts.NotFoundValue = &notFoundValue
+		}
+		if len(outputColumns) > 0 {
+			// 指定された列に必要な情報は取得する
+			withDividends = withDividends || outputOpts.hasColumn("dividend")
+			withMetadata = withMetadata || outputOpts.hasColumn("market") || outputOpts.hasColumn("industry")
+			withIndexMembership = withIndexMembership || outputOpts.hasColumn("nikkei225") || outputOpts.hasColumn("topix")
+			withCurrentPrice = withCurrentPrice || outputOpts.hasColumn("current_price") || outputOpts.hasColumn("current_price_at")
+		}
+		// --sheet-by でシートを分ける列に必要な情報も取得する
+		withMetadata = withMetadata || sheetBy == "market" || sheetBy == "industry"
+		withIndexMembership = withIndexMembership || sheetBy == "nikkei225" || sheetBy == "topix"
+		// 途中でエラーが発生して終了する場合も、それまでに取得できた結果が残るよう
+		// 出力ファイルへの書き出しと後始末はすべての終了経路で defer で行う
+		output, err := openOutputs(targets, appendOutput, outputOpts, flushEvery, flushInterval)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := output.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+
+		// create error output file
+		var errorRows *errorFile
+		if errorOutput != "" {
+			errorRows, err = createErrorFile(errorOutput, lang, multipleInputs)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if closeErr := errorRows.Close(); closeErr != nil && err == nil {
+					err = closeErr
+				}
+			}()
+		}
+
+		// 出力ファイルの件数と照合するための、処理した行・失敗した行・対象外のコードの行・欠けた年がある行・
+		// --min-price の条件を満たさなかった行の件数
+		dispatched, failed, filteredRows, incompleteRows, screenedRows := 0, 0, 0, 0, 0
+		previewed := 0
+		// 連続して失敗した件数 (--fail-fast-threshold 用)
+		consecutiveFailures := 0
+
+		// runOptions は入力ファイルの各行を Run で処理し、結果を出力ファイルに書き出す設定を作る。
+		// Run はフックを同時に呼び出さないため、件数や出力ファイルは排他制御せずに更新する
+		runOptions := func(inputFile string, rows rowIterator, shuffle *rand.Rand) RunOptions {
+			file := fileIndex[inputFile]
+			// recordResult は出力まで終わった企業を見つかった / 見つからなかったに分けて集計する
+			recordResult := func(line int, result ScrapeResult) {
+				found := result.StockCode != ""
+				report.recordResult(found)
+				if !found {
+					notFound.add(notFoundRow{file: file, inputFile: inputFile, line: line, name: result.CompanyName})
+				}
+			}
+			return RunOptions{
+				Source:              source,
+				Concurrency:         concurrency,
+				WithDividends:       withDividends,
+				WithMetadata:        withMetadata,
+				WithIndexMembership: withIndexMembership,
+				WithCurrentPrice:    withCurrentPrice,
+				rows:                rows,
+				shuffle:             shuffle,
+				ramp:                ramp,
+				Accept: func(line int, result ScrapeResult) bool {
+					consecutiveFailures = 0
+					// コードが分かった企業と、検索して見つからなかった企業を記録する
+					resolvedCodes.add(savedCode{file: file, line: line, Name: result.CompanyName, Code: result.StockCode, Found: result.StockCode != ""})
+					if result.StockCode != "" && granularity == granularityYear && !noHistory {
+						foundYears := result.FoundYears()
+						if len(foundYears) < len(targetYears) {
+							logger.Printf("%d: %s は %d 年分中 %d 年分の終値しか取得できませんでした: %v", line, result.CompanyName, len(targetYears), len(foundYears), foundYears)
+						}
+					}
+					// 見つからなかった企業も含め、すべての年の終値が揃っていない企業は出力しない
+					if requireComplete && len(result.FoundYears()) < len(targetYears) {
+						logger.Printf("%d: %s は終値が欠けている年があるため出力しません (--require-complete)", line, result.CompanyName)
+						incompleteRows++
+						report.recordIncomplete()
+						recordResult(line, result)
+						return false
+					}
+					if condition, ok := failedMinPrice(result); !ok {
+						logger.Printf("%d: %s は %d 年の終値が %s 未満のため出力しません (--min-price)", line, result.CompanyName, condition.year, strconv.FormatFloat(condition.price, 'f', -1, 64))
+						screenedRows++
+						report.recordScreened()
+						recordResult(line, result)
+						return false
+					}
+					return true
+				},
+				OnResult: func(line int, result ScrapeResult) error {
+					result.InputFile = inputFile
+					// 解析結果が正しいかを早めに確認できるよう、最初の数件はログにも出力する
+					if previewed < preview {
+						previewed++
+						logger.Printf("プレビュー %s", formatPreview(line, result))
+					}
+					// 結果はすべての出力ファイルに書き込む
+					if err := output.write(result); err != nil {
+						return err
+					}
+					recordResult(line, result)
+					return nil
+				},
+				OnSkip: func(line int, result ScrapeResult) {
+					consecutiveFailures = 0
+					resolvedCodes.add(savedCode{file: file, line: line, Name: result.CompanyName, Code: result.StockCode, Found: true})
+					filteredRows++
+				},
+				OnError: func(rowErr RowError) error {
+					line, companyName, err := rowErr.Index, rowErr.CompanyName, rowErr.Err
+					// 株価の取得に失敗した場合も、コードが分かった企業は記録する
+					if rowErr.StockCode != "" {
+						resolvedCodes.add(savedCode{file: file, line: line, Name: companyName, Code: rowErr.StockCode, Found: true})
+					}
+					failed++
+					consecutiveFailures++
+					report.recordError(err)
+
+					// 失敗した行をログとエラー出力ファイルに記録する
+					logWithFields("error", logFields{Company: companyName, Index: &line}, "%d: %s の処理に失敗しました: %v", line, companyName, err)
+					var recordErr error
+					if errorRows != nil {
+						recordErr = errorRows.write(rowErr, inputFile)
+					}
+					if failFastThreshold > 0 && consecutiveFailures >= failFastThreshold {
+						return fmt.Errorf("%d 件連続で失敗したため処理を中断します。日経のサイトの状況を確認してください: %w", failFastThreshold, err)
+					}
+					var pe *panicError
+					if continueOnError || errors.As(err, &pe) {
+						return recordErr
+					}
+					return err
+				},
+			}
+		}
+
+		if seed == 0 && (sample > 0 || shuffleInput) {
+			seed = time.Now().UnixNano()
+		}
+		// --sample の場合は処理する行を先に選んでおく
+		var sampled map[sampleRow]bool
+		if sample > 0 {
+			sampled, err = sampleRows(inputSrcs, countInput, sample, seed)
+			if err != nil {
+				return err
+			}
+			logger.Printf("%d 行を無作為に選んで処理します (同じ行を選ぶには --seed %d を指定してください)", len(sampled), seed)
+		}
+		// 誤ったファイルを指定して大量の企業を取得し始めないよう、処理する行数を先に確認する
+		if maxRows > 0 && !yes {
+			rows := len(sampled)
+			if sampled == nil {
+				rows, err = countRows(inputSrcs, countInput)
+				if err != nil {
+					return err
+				}
+			}
+			if rows > maxRows {
+				if err := confirmMaxRows(rows, maxRows); err != nil {
+					return err
+				}
+			}
+		}
+
+		// --shuffle-input の場合は入力ファイルごとに行を並べ替えてから処理する
+		var shuffle *rand.Rand
+		if shuffleInput {
+			shuffle = rand.New(rand.NewSource(seed))
+			logger.Printf("入力ファイルの行を並べ替えて処理します (同じ順番で処理するには --seed %d を指定してください)", seed)
+		}
+
+		// read csv
+		var incompleteFiles []string
+		for i, inputFile := range inputFiles {
+			i, inputFile := i, inputFile
+			// --deadline-per-file の場合は入力ファイルごとに期限付きの ctx で処理する
+			fileCtx, cancelFile := ctx, context.CancelFunc(func() {})
+			if deadlinePerFile > 0 {
+				fileCtx, cancelFile = context.WithTimeout(ctx, deadlinePerFile)
+			}
+			err = readSource(inputSrcs[i], readInput, func(next rowIterator) error {
+				// --sample で選ばれなかった行は読み飛ばし、処理した行を数える
+				rows := func() (inputRow, bool, error) {
+					for {
+						row, ok, err := next()
+						if err != nil || !ok {
+							return row, ok, err
+						}
+						if sampled != nil && !sampled[sampleRow{file: i, line: row.number}] {
+							continue
+						}
+						dispatched++
+						return row, true, nil
+					}
+				}
+				_, _, err := Run(fileCtx, runOptions(inputFile, rows, shuffle))
+				return err
+			})
+			fileErr := fileCtx.Err()
+			cancelFile()
+			// 実行全体ではなくこのファイルの期限を過ぎた場合は、残りの行を処理せずに次のファイルに進む
+			if errors.Is(fileErr, context.DeadlineExceeded) && ctx.Err() == nil {
+				logger.Printf("%s は --deadline-per-file (%s) を過ぎたため、残りの行を処理せずに次の入力ファイルに進みます", inputFile, deadlinePerFile)
+				incompleteFiles = append(incompleteFiles, inputFile)
+				report.recordIncompleteFile(inputFile)
+				err = nil
+				continue
+			}
+			if err != nil {
+				break
+			}
+		}
+		if len(incompleteFiles) > 0 {
+			logger.Printf("--deadline-per-file を過ぎたため最後まで処理できなかった入力ファイル: %s", strings.Join(incompleteFiles, ", "))
+		}
+		if scraper.Verbose {
+			scraper.timings.logSummary(logger)
+		}
+		if retries := scraper.totalRetries(); retries > 0 {
+			logger.Printf("リトライは合計 %d 回でした", retries)
+		}
+		if proxyPool != nil {
+			proxyPool.logSummary()
+		}
+
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return fmt.Errorf("中断されたため処理を終了しました。それまでに取得できた結果は出力済みです: %w", ctx.Err())
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("--max-runtime (%s) を過ぎたため処理を中断しました。それまでに取得できた結果は出力済みです: %w", maxRuntime, ctx.Err())
+		}
+		if err != nil {
+			return err
+		}
+		// 処理した行がすべて出力ファイルかエラーのどちらかに記録されていることを確認する
+		written := output.written
+		if dispatched != written+failed+filteredRows+incompleteRows+screenedRows {
+			return fmt.Errorf("処理した %d 行と、出力した %d 件・失敗した %d 件・対象外のコードの %d 件・欠けた年がある %d 件・終値の条件を満たさない %d 件の合計が一致しません。出力ファイルに書き出されていない企業があります", dispatched, written, failed, filteredRows, incompleteRows, screenedRows)
+		}
+		logger.Printf("%d 行を処理しました (出力: %d 件, 失敗: %d 件, 対象外のコード: %d 件, 欠けた年がある: %d 件, 終値の条件を満たさない: %d 件)", dispatched, written, failed, filteredRows, incompleteRows, screenedRows)
+		// 出力は書き出したうえで、見つからなかった企業が多すぎる場合は失敗として終了する
+		if ratio := report.notFoundRatio(); ratio > maxNotFoundRatio {
+			return fmt.Errorf("見つからなかった企業の割合 (%.1f%%) が --max-not-found-ratio (%.1f%%) を超えました。入力ファイルや日経のサイトの構成を確認してください", ratio*100, maxNotFoundRatio*100)
+		}
+		return nil
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+// The returned error is left to the caller to decide the exit code.
+func Execute() error {
+	return rootCmd.Execute()
+}
+
+func init() {
+	cobra.OnInitialize(initConfig)
+
+	// Here you will define your flags and configuration settings.
+	// Cobra supports persistent flags, which, if defined here,
+	// will be global for your application.
+
+	rootCmd.Flags().Bool("print-config", false, "コマンドライン引数・設定ファイル・デフォルト値を反映した設定を標準エラー出力に表示し、スクレイピングせずに終了します")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "設定ファイル (YAML) のパスを指定してください (デフォルトは $HOME/.scrape-nikkei-past-price.yaml)")
+
+	// Cobra also supports local flags, which will only run
+	// when this action is called directly.
+	rootCmd.Flags().StringArray("input", nil, "入力用のcsvファイルのパスを指定してください (複数回の指定や *.csv のようなパターン、http(s):// の URL も可)")
+	rootCmd.MarkFlagFilename("input", "csv")
+	rootCmd.MarkFlagRequired("input")
+
+	rootCmd.Flags().Int("header", 1, "ヘッダとして読み飛ばす行数を指定してください (ヘッダが無い場合は 0)。出力の index はヘッダの次の行を 1 として数えます")
+
+	rootCmd.Flags().Int("fallback-column", 0, "企業名で見つからなかった場合に検索に使う値 (証券コードなど) の列番号を 1 始まりで指定してください (0 の場合は利用しません)")
+	rootCmd.Flags().String("input-delimiter", ",", "入力ファイルの区切り文字を指定してください (タブ区切りの場合は \\t)")
+
+	rootCmd.Flags().Bool("no-search", false, "日経の検索を使わず、--code-column (JSON の場合は code) のコードをそのまま使います。コードが無いか不正な行はエラーになります")
+	rootCmd.Flags().Int("code-column", 0, "--no-search でそのまま使う証券コードの列番号を 1 始まりで指定してください")
+	rootCmd.Flags().String("input-format", inputFormatCSV, "入力ファイルの形式を指定してください (csv, json)")
+	rootCmd.Flags().Bool("stream-input", false, "入力ファイル全体をメモリに読み込まず、変換しながら読み込みます (エンコーディングはファイルの先頭から判定します)")
+	rootCmd.Flags().String("comment-char", "", "入力ファイルでこの文字から始まる行をコメントとして読み飛ばします (例: #)")
+	rootCmd.Flags().String("input-encoding", "", "入力ファイルのエンコーディングを指定してください (例: shift_jis, utf-8。未指定の場合は自動で判定し、判定できなければ UTF-8 として読み込みます)")
+	rootCmd.Flags().Int("sample", 0, "入力ファイルのデータ行から指定した行数を無作為に選んで処理します (0 の場合はすべての行を処理します)")
+	rootCmd.Flags().Bool("shuffle-input", false, "入力ファイルの行を無作為に並べ替えた順番で処理します (出力の順番は並べ替えの影響を受けず、index 列で元の順番が分かります)")
+	rootCmd.Flags().Int64("seed", 0, "--sample で行を選ぶ際や --shuffle-input で並べ替える際の乱数のシードを指定してください (0 の場合は実行ごとに変わります)")
+
+	rootCmd.Flags().StringArray("output", nil, "出力ファイルのパスを指定してください (複数回指定すると同じ結果をそれぞれの形式で出力します。形式は拡張子から推測します)")
+	rootCmd.MarkFlagRequired("output")
+
+	rootCmd.Flags().Bool("gzip", false, "出力ファイルを gzip で圧縮します (--output の拡張子が .gz の場合は指定しなくても圧縮します)")
+	rootCmd.Flags().Bool("append", false, "出力ファイルが既にある場合は上書きせず末尾に追記します")
+	rootCmd.Flags().Bool("no-header", false, "CSV の出力ファイルにヘッダ行を書き込みません")
+	rootCmd.Flags().Bool("always-quote", false, "CSV の出力ファイルのすべての値 (数値や空欄も含む) をダブルクォートで囲みます")
+
+	rootCmd.Flags().String("format", "csv", "出力形式を指定してください (csv, sqlite, ndjson, json, xlsx)")
+	rootCmd.Flags().Bool("pretty", false, "--format json の出力を 2 文字の空白でインデントします")
+	rootCmd.Flags().String("sheet-by", "", "--format xlsx の場合に、指定した列 (market など) の値ごとにシートを分けます (値が空の企業は「未分類」のシートに書き込みます)")
+
+	rootCmd.Flags().String("report", "", "実行結果の集計 (件数、エラーの種類ごとの件数、開始・終了時刻、指定されたフラグ) を書き出す JSON ファイルのパスを指定してください")
+	rootCmd.Flags().String("lockfile", "", "ロックファイルのパスを指定してください。同じロックファイルを指定した他の実行が終わっていない場合は終了します")
+	rootCmd.Flags().Duration("lock-wait", 0, "--lockfile が他の実行にロックされている場合に解放を待つ時間を指定してください (例: 10m)")
+	rootCmd.Flags().Bool("mkdir", false, "出力ファイルのディレクトリが無い場合に作成します")
+	rootCmd.Flags().String("save-codes", "", "検索して分かった企業名とコードの対応を書き出すファイルのパスを指定してください (.json の場合は JSON、それ以外は csv)")
+	rootCmd.Flags().String("metrics-file", "", "実行結果の件数とリクエストの所要時間を Prometheus のテキスト形式で書き出すファイルのパスを指定してください")
+	rootCmd.Flags().String("notfound-output", "", "日経のサイトで見つからなかった企業 (企業名、index) を入力ファイルの順番で書き出す csv ファイルのパスを指定してください")
+	rootCmd.Flags().String("error-output", "", "処理に失敗した企業を書き出すcsvファイルのパスを指定してください")
 
 	rootCmd.Flags().Int64("concurrency", 5, "最大同時実行数を指定してください")
+	rootCmd.Flags().Int64("workers-per-host", 0, "リクエスト先のホストごとの最大同時リクエスト数を指定してください (0 の場合は --concurrency と同じ)")
+
+	rootCmd.Flags().String("log-format", "text", "ログの出力形式を指定してください (text, json)")
+
+	rootCmd.Flags().Int("max-idle-conns-per-host", defaultMaxIdleConnsPerHost, "日経のサイトへの接続を使い回すために保持しておく接続数を指定してください (--concurrency 以上を推奨)")
+	rootCmd.Flags().String("fallback-source", "", "日経のサイトから取得できなかった企業を取得し直す取得元を 種類:引数 の形式で指定してください (例: ndjson:./previous.ndjson)")
+	rootCmd.Flags().Bool("warmup", false, "取得を始める前に日経のサイトのトップページを取得し、設定されたセッションの Cookie を以降のリクエストでも送ります")
+	rootCmd.Flags().String("http-cache-dir", "", "取得したページを保存するディレクトリを指定してください。--http-cache-ttl 以内に同じページを取得する場合は保存したものを使います")
+	rootCmd.Flags().Duration("http-cache-ttl", 24*time.Hour, "--http-cache-dir に保存したページを使う期間を指定してください (0 の場合は期限なし)")
+	rootCmd.Flags().StringArray("proxy", nil, "日経のサイトへのリクエストに使うプロキシの URL を指定してください (複数回指定するとリクエストごとに順番に使います。未指定の場合は環境変数 HTTP_PROXY / HTTPS_PROXY に従います)")
+	rootCmd.Flags().String("cassette", "", "日経のサイトへのリクエストとレスポンスを記録・再生する cassette (JSON) のパスを指定してください")
+	rootCmd.Flags().String("cassette-mode", CassetteReplay, "--cassette の使い方を指定してください (record: リクエストを送って記録する, replay: リクエストを送らずに記録したレスポンスを返す)")
+	rootCmd.Flags().String("proxy-list", "", "--proxy に加えて使うプロキシの URL を 1 行に 1 つずつ書いたファイルのパスを指定してください")
+	rootCmd.Flags().Duration("proxy-cooldown", proxyCooldown, "複数のプロキシを使う場合に、接続の失敗や 403 / 429 が続いたプロキシを使わない時間を指定してください")
+
+	rootCmd.Flags().Bool("respect-robots", false, "nikkei.com の robots.txt を確認し、禁止されているページは取得しません")
+	rootCmd.Flags().Bool("force", false, "--respect-robots を指定していても robots.txt で禁止されているページを取得します")
+
+	rootCmd.Flags().StringArray("search-param", nil, "日経の検索に追加するクエリパラメータを key=value の形式で指定してください (複数回指定できます)")
+	rootCmd.Flags().Bool("adaptive-delay", false, "日経のサイトから 429 / 403 が返った場合にリクエストの間隔を広げ、返らなくなったら --min-delay まで戻します")
+	rootCmd.Flags().Duration("max-delay", 30*time.Second, "--adaptive-delay で広げるリクエストの間隔の上限を指定してください")
+	rootCmd.Flags().Int("retries", 0, "通信に失敗した場合や 429・5xx が返った場合にリトライする最大回数を指定してください")
+	rootCmd.Flags().Int("retry-empty", 0, "企業名の検索結果が空だった場合に、通信の失敗とは別に検索し直す最大回数を指定してください")
+	rootCmd.Flags().Bool("normalize-company-suffix", false, "企業名で見つからなかった場合に、株式会社の有無や位置、全角・半角を変えた企業名で検索し直します")
+	rootCmd.Flags().Int64("retry-budget", 0, "実行全体でリトライする回数の上限を指定してください。上限に達した後は失敗したリクエストをリトライしません (0 の場合は無制限)")
+	rootCmd.Flags().Int("timeout-retries", -1, "タイムアウトや接続の失敗の場合にリトライする最大回数を指定してください (-1 の場合は --retries と同じ)")
+	rootCmd.Flags().Duration("backoff-base", defaultBackoff.Base, "1 回目のリトライまでの間隔を指定してください")
+	rootCmd.Flags().Float64("backoff-multiplier", defaultBackoff.Multiplier, "リトライごとに間隔を何倍にするかを指定してください")
+	rootCmd.Flags().Duration("backoff-max", defaultBackoff.Max, "リトライの間隔の上限を指定してください")
+	rootCmd.Flags().Bool("backoff-jitter", defaultBackoff.Jitter, "リトライの間隔を 0 から計算した間隔までの乱数にします (--backoff-jitter=false で無効)")
+	rootCmd.Flags().String("include-codes", "", "株価を取得するコードをカンマ区切りで指定してください (@ファイル名 でファイルから読み込めます)")
+	rootCmd.Flags().String("exclude-codes", "", "株価を取得しないコードをカンマ区切りで指定してください (@ファイル名 でファイルから読み込めます)")
+	rootCmd.Flags().Int("preview", 0, "最初に処理が終わった指定した件数の企業の解析結果を標準エラー出力に表示します (出力ファイルの内容は変わりません)")
+	rootCmd.Flags().Bool("interactive", false, "検索結果で企業を特定できなかった場合に、端末に候補を表示して選べるようにします")
+	rootCmd.Flags().BoolP("verbose", "v", false, "リクエストごと・企業ごとの所要時間と、終了時にその集計 (min/avg/max/p95) をログに出力します")
+	rootCmd.Flags().Duration("ramp-up", 0, "開始直後に全ワーカーが一斉にリクエストを送らないよう、指定した時間をかけてワーカーを少しずつ動かし始めます (例: 5s。0 の場合は一斉に開始します)")
+	rootCmd.Flags().Duration("min-delay", 0, "各ワーカーがリクエストごとに待機する最小時間を指定してください (例: 500ms, 2s)")
+
+	rootCmd.Flags().Bool("continue-on-error", false, "企業ごとの処理に失敗しても中断せずに残りの企業の処理を続けます")
+	rootCmd.Flags().Int("fail-fast-threshold", 0, "指定した件数だけ連続で失敗した場合に処理を中断します (0 の場合は中断しません)")
+
+	rootCmd.Flags().String("debug-dump", "", "終値や出来高の解析に失敗したセルの文字列を <コード>.txt として書き出すディレクトリを指定してください")
+	rootCmd.Flags().Bool("debug-dump-html", false, "--debug-dump のディレクトリに株価の表全体の HTML も <コード>.html として書き出します")
+	rootCmd.Flags().Float64("max-not-found-ratio", 1, "処理した企業のうち見つからなかった企業の割合がこの値 (0 ~ 1) を超えた場合はエラーで終了します")
+	rootCmd.Flags().Int64("max-request-bytes", defaultMaxResponseBytes, "1 ページのレスポンスの本文として読み込むバイト数の上限を指定してください。超えた場合はその企業のみ失敗とします (0 の場合は無制限)")
+	rootCmd.Flags().Duration("per-request-timeout", 0, "1 ページの取得にかける時間の上限を指定してください。過ぎた場合はその企業のみ失敗とします (例: 30s。0 の場合は無制限)")
+	rootCmd.Flags().Duration("deadline-per-file", 0, "入力ファイルごとの処理時間の上限を指定してください。過ぎた場合は残りの行を処理せずに次の入力ファイルに進みます (0 の場合は無制限)")
+	rootCmd.Flags().Duration("max-runtime", 0, "実行時間の上限を指定してください。過ぎた場合はそれまでの結果を出力して終了します (例: 30m, 2h。0 の場合は無制限)")
+	rootCmd.Flags().Int("max-rows", 0, "処理する行数が指定した行数を超える場合は開始前に確認し、端末から実行されていない場合は中止します (0 の場合は無制限)")
+	rootCmd.Flags().Bool("yes", false, "--max-rows を超える場合も確認せずに処理します")
+	rootCmd.Flags().Int("flush-every", 0, "指定した件数ごとに出力ファイルへ書き出します (0 の場合は終了時のみ)")
+	rootCmd.Flags().Duration("flush-interval", 10*time.Second, "前回の書き出しから指定した時間が経過していれば出力ファイルへ書き出します (0 の場合は無効)")
+
+	rootCmd.Flags().String("columns", "", "出力する列とその順番をカンマ区切りで指定してください (例: company,code,close)")
+	rootCmd.Flags().String("notfound-value", "", "見つからなかった企業のコードと株価の列に書き出す値を指定してください (例: N/A。未指定の場合はコードを空欄、株価を 0 にします)")
+	rootCmd.Flags().String("header-template", "", "出力する列とその列名をカンマ区切りの 列=列名 で指定してください (例: code=銘柄コード,close=Close。@ファイル名 でファイルから読み込めます)")
+	rootCmd.Flags().String("lang", "ja", "出力ファイルのヘッダ行の言語を指定してください (ja, en)")
+	rootCmd.Flags().Int("precision", 1, "価格を出力する際の小数点以下の桁数を指定してください")
+	rootCmd.Flags().Bool("integer-prices", false, "整数の価格は小数点以下を付けずに出力します (それ以外の価格は --precision の桁数で出力します)")
+	rootCmd.Flags().String("granularity", granularityYear, "株価を取得する単位を指定してください (year: 年ごと, month: 月ごと)")
+	rootCmd.Flags().Bool("long", false, "1 行に 1 企業・1 年分を出力する縦持ち形式で出力します")
+	rootCmd.Flags().String("years", "", "年ごとの列を出力する年をカンマ区切りで指定してください (例: 2013,2018,2022。指定した順番で出力し、値が無い年は空欄にします)")
+	rootCmd.Flags().Bool("transpose", false, "年を行、企業を列にした終値の表を出力します (すべての結果をメモリに溜めてから書き出すため、--max-rows で企業の数を制限できます)")
+	rootCmd.Flags().Bool("with-volume", false, "各年の出来高の列を出力に追加します")
+	rootCmd.Flags().Bool("with-open", false, "各年の始値の列を出力に追加します")
+	rootCmd.Flags().Bool("with-dividends", false, "各年の 1 株あたり配当の列を出力に追加します")
+	rootCmd.Flags().Bool("with-metadata", false, "上場市場と業種の列を出力に追加します")
+	rootCmd.Flags().Bool("with-index-membership", false, "日経平均・TOPIX の構成銘柄かどうか (1 / 0) の列を出力に追加します")
+	rootCmd.Flags().String("history-section", defaultHistorySection, "年ごとの株価を取得する表の見出し (に含まれる文言) を指定してください。見つからない場合は年間高安（過去10年）の表から取得します")
+	rootCmd.Flags().Bool("zero-is-error", false, "終値が 0 の年がある企業を解析の失敗として扱います (--error-output に記録します)")
+	rootCmd.Flags().StringArray("min-price", nil, "指定した年の終値が指定した値以上の企業だけを 年:終値 の形式で指定してください (例: 2020:1000。複数回指定するとすべてを満たす企業だけを出力します)")
+	rootCmd.Flags().Bool("require-complete", false, "出力対象のすべての年の終値を取得できた企業だけを出力します")
+	rootCmd.Flags().String("fields", "", "年間高安の表から取得して出力する列の見出しをカンマ区切りで指定してください (例: 始値,高値,安値,終値,出来高)")
+	rootCmd.Flags().Float64("split-warn-ratio", splitWarnRatio, "終値が前年からこの倍率以上に変化した (または 1/倍率 以下になった) 企業を、株式分割が調整されていない疑いとして警告します (0 の場合は確認しません)")
+	rootCmd.Flags().Bool("no-history", false, "株価のページを取得せず、コードと --with-metadata などの付加情報だけを出力します")
+	rootCmd.Flags().Bool("with-raw-prices", false, "日経のサイトに表示されている終値の文字列 (解析前) の列を出力に追加します")
+	rootCmd.Flags().Bool("dates-as-columns", false, "年ごとに高値・安値を付けた日付 (例: 2022-12-30) の列を出力に追加します")
+	rootCmd.Flags().Bool("with-split-check", false, "株式分割の調整済みかどうか (1 / 0) と、調整されていない疑いのある年の列を出力に追加します")
+	rootCmd.Flags().Bool("with-period-range", false, "年間高安の表にある期間全体の高値・安値の列を出力に追加します")
+	rootCmd.Flags().Bool("with-current-price", false, "企業ページに表示されている取得時点の現在値 (取引時間外は直近の終値) とその日時の列を出力に追加します")
+	rootCmd.Flags().Bool("with-valuation", false, "取得時点の PER・PBR・時価総額 (百万円) の列と、取得日時 (fetched_at) の列を出力に追加します")
+	rootCmd.Flags().Bool("output-append-index", true, "入力ファイルの行番号 (index) の列を出力します (--output-append-index=false で出力しません)")
+	rootCmd.Flags().Bool("code-first", false, "コードの列を企業名の列より前の先頭の列として出力します")
+	rootCmd.Flags().Bool("with-found-years", false, "終値を取得できた年の一覧の列を出力に追加します")
+	rootCmd.Flags().Bool("with-years-found", false, "出力対象の年のうち終値を取得できた年の数の列を出力に追加します")
+	rootCmd.Flags().Bool("with-quality-score", false, "コードが見つかったか・終値を取得できた年の数などから計算した 0 から 100 のデータ品質スコアの列を出力に追加します")
+	rootCmd.Flags().Bool("with-provenance", false, "株価の取得日時 (fetched_at) と取得元 URL (source_url) の列を出力に追加します")
 }
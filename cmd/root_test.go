@@ -0,0 +1,261 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// errTestRow はテストで行の処理に失敗したことを表すエラー
+var errTestRow = errors.New("行の処理に失敗しました")
+
+// testRows は企業名だけの行を返す rowIterator を作る。
+func testRows(names ...string) rowIterator {
+	rows := make([]inputRow, len(names))
+	for i, name := range names {
+		rows[i] = inputRow{number: i + 1, companyName: name}
+	}
+	return sliceRows(rows)
+}
+
+// collectRows は read が dispatch に渡す rowIterator の行をすべて返す。
+func collectRows(t *testing.T, read func(dispatch func(next rowIterator) error) error) []inputRow {
+	t.Helper()
+	var rows []inputRow
+	err := read(func(next rowIterator) error {
+		for {
+			row, ok, err := next()
+			if err != nil || !ok {
+				return err
+			}
+			rows = append(rows, row)
+		}
+	})
+	if err != nil {
+		t.Fatalf("read error = %v", err)
+	}
+	return rows
+}
+
+func TestReadCsvIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		header  int
+		comment rune
+		want    []inputRow
+	}{
+		{
+			name:   "headerless",
+			input:  "トヨタ自動車,7203\nソニーグループ,6758\n",
+			header: 0,
+			want:   []inputRow{{number: 1, companyName: "トヨタ自動車", fallback: "7203"}, {number: 2, companyName: "ソニーグループ", fallback: "6758"}},
+		},
+		{
+			name:   "header",
+			input:  "企業名,コード\nトヨタ自動車,7203\nソニーグループ,6758\n",
+			header: 1,
+			want:   []inputRow{{number: 1, companyName: "トヨタ自動車", fallback: "7203"}, {number: 2, companyName: "ソニーグループ", fallback: "6758"}},
+		},
+		{
+			name:    "comment",
+			input:   "企業名,コード\n# 自動車\nトヨタ自動車,7203\n",
+			header:  1,
+			comment: '#',
+			want:    []inputRow{{number: 2, companyName: "トヨタ自動車", fallback: "7203"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectRows(t, func(dispatch func(next rowIterator) error) error {
+				return readCsvTo(discardLogger{}, strings.NewReader(tt.input), ',', tt.comment, tt.header, 1, dispatch)
+			})
+			if len(got) != len(tt.want) {
+				t.Fatalf("rows = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadJSONIndex(t *testing.T) {
+	got := collectRows(t, func(dispatch func(next rowIterator) error) error {
+		return readJSON(discardLogger{}, strings.NewReader(`[{"name":"トヨタ自動車","code":"7203"}]`), dispatch)
+	})
+	if len(got) != 1 || got[0].number != 1 {
+		t.Errorf("rows = %+v, want the first element as index 1", got)
+	}
+}
+
+func TestDispatchRowsCanceledKeepsRowErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sem  *semaphore.Weighted
+	}{
+		{name: "concurrent", sem: semaphore.NewWeighted(1)},
+		{name: "sequential", sem: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err := dispatchRows(ctx, tt.sem, testRows("A", "B", "C"), nil, func(number int, name, fallback string) error {
+				if number == 1 {
+					cancel()
+					// 次の行の空きを待っている間に中断されるようにする
+					time.Sleep(20 * time.Millisecond)
+					return errTestRow
+				}
+				t.Errorf("row %d was started after the cancellation", number)
+				return nil
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("dispatchRows() error = %v, want context.Canceled", err)
+			}
+			if !errors.Is(err, errTestRow) {
+				t.Errorf("dispatchRows() error = %v, want the error of row 1", err)
+			}
+		})
+	}
+}
+
+func TestRowErrorsIsAs(t *testing.T) {
+	err := joinRowErrors([]rowError{
+		{row: inputRow{number: 2, companyName: "B"}, err: errTestRow},
+		{row: inputRow{number: 1, companyName: "A"}, err: &HTTPStatusError{StatusCode: 429, message: "429"}},
+	})
+	var re rowErrors
+	if !errors.As(err, &re) || len(re) != 2 || re[0].row.number != 1 {
+		t.Fatalf("joinRowErrors() = %#v, want rowErrors sorted by row", err)
+	}
+	if !re.Is(errTestRow) || !errors.Is(err, errTestRow) {
+		t.Errorf("errors.Is(%v, errTestRow) = false", err)
+	}
+	if !re.Is(ErrHTTPStatus) {
+		t.Errorf("rowErrors.Is(ErrHTTPStatus) = false")
+	}
+	if re.Is(ErrCompanyNotFound) {
+		t.Errorf("rowErrors.Is(ErrCompanyNotFound) = true")
+	}
+	var statusErr *HTTPStatusError
+	if !re.As(&statusErr) || statusErr.StatusCode != 429 {
+		t.Errorf("rowErrors.As(*HTTPStatusError) = %v", statusErr)
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		wantOK  bool
+		wantErr bool
+	}{
+		{text: "¥1,234", want: 1234, wantOK: true},
+		{text: "￥１，２３４", want: 1234, wantOK: true},
+		{text: "1,234円", want: 1234, wantOK: true},
+		{text: "1,234(12/30)", want: 1234, wantOK: true},
+		{text: " 1,234 \n", want: 1234, wantOK: true},
+		{text: "1, 234", want: 1234, wantOK: true},
+		{text: "　1,234.5　", want: 1234.5, wantOK: true},
+		{text: "--", wantOK: false},
+		{text: "―", wantOK: false},
+		{text: "ー", wantOK: false},
+		{text: "", wantOK: false},
+		{text: " 　 ", wantOK: false},
+		{text: "-12.5", want: -12.5, wantOK: true},
+		{text: "△12.5", want: -12.5, wantOK: true},
+		{text: "▲1,000", want: -1000, wantOK: true},
+		{text: "(1,234)", want: -1234, wantOK: true},
+		{text: "（１，２３４）", want: -1234, wantOK: true},
+		{text: "abc", wantErr: true},
+		{text: "1,234abc", wantErr: true},
+		{text: "¥", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok, err := parsePrice(tt.text)
+			if tt.wantErr {
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("parsePrice(%q) error = %v, want *ParseError", tt.text, err)
+				}
+				if ok || got != 0 {
+					t.Errorf("parsePrice(%q) = (%v, %v), want (0, false) with an error", tt.text, got, ok)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePrice(%q) error = %v", tt.text, err)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parsePrice(%q) = (%v, %v), want (%v, %v)", tt.text, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseYearlyPricesYearLabels(t *testing.T) {
+	tests := []struct {
+		name, page string
+	}{
+		// "2013年" のように年が付いた表記
+		{name: "with suffix", page: "yprice/7203.html"},
+		// "2013" や全角の "２０１３" のように年が付かない表記
+		{name: "without suffix", page: "yprice/7203_year_without_suffix.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkYpriceCloses(t, parseTestPage(t, tt.page))
+		})
+	}
+}
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    int
+		wantErr bool
+	}{
+		{text: "2013年", want: 2013},
+		{text: "2013", want: 2013},
+		{text: "2013 年", want: 2013},
+		{text: "2013年度", want: 2013},
+		{text: "２０１３年", want: 2013},
+		{text: " 2013\n", want: 2013},
+		{text: "過去10年", wantErr: true},
+		{text: "13年", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseYear(tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseYear(%q) = (%d, %v), want (%d, error: %v)", tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseYearlyPricesInsertedColumn(t *testing.T) {
+	// 安値と終値の間に「前年比」の列が追加されたページ
+	result := parseTestPage(t, "yprice/7203_inserted_column.html")
+
+	checkYpriceCloses(t, result)
+	if result.Opens[2013] != 1111 || result.Volumes[2013] != 14321098700 {
+		t.Errorf("Opens[2013] = %v, Volumes[2013] = %v, want 1111 and 14321098700", result.Opens[2013], result.Volumes[2013])
+	}
+	if result.LowDates[2016] != "2016-06-24" {
+		t.Errorf("LowDates[2016] = %q, want 2016-06-24", result.LowDates[2016])
+	}
+	if result.PeriodLow == nil || *result.PeriodLow != 1010 {
+		t.Errorf("PeriodLow = %v, want 1010", result.PeriodLow)
+	}
+}
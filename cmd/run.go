@@ -0,0 +1,211 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Company は Run で株価を取得する企業
+type Company struct {
+	// 企業名
+	Name string
+	// 企業名で見つからなかった場合に使うコードなど (入力ファイルの --fallback-column の値。--no-search の場合は --code-column のコード)
+	Fallback string
+}
+
+// RunOptions は Run の設定
+type RunOptions struct {
+	// 株価を取得する企業
+	Companies []Company
+	// 株価の取得元。nil の場合は NewScraper の Scraper を使う
+	Source PriceSource
+	// 最大同時実行数。1 以下の場合は goroutine を使わずに 1 企業ずつ順番に処理する
+	Concurrency int64
+	// 配当・上場市場と業種・日経平均と TOPIX の構成銘柄かどうか・現在値も取得するかどうか
+	WithDividends, WithMetadata, WithIndexMembership, WithCurrentPrice bool
+	// 企業ごとの処理のログの出力先。nil の場合は Source の Scraper の Logger
+	// (それも nil の場合はパッケージのロガー) を使う
+	Logger Logger
+
+	// Accept は株価を取得できた企業を出力するかどうかを判定する (--require-complete や --min-price)。
+	// false を返した企業は付加情報を取得せず、結果にも含めない。nil の場合はすべての企業を出力する
+	Accept func(index int, result ScrapeResult) bool
+	// OnResult は出力する企業の結果を、処理が終わった順番に受け取る。指定した場合は結果を返さない。
+	// エラーを返すと新しい企業の処理を始めず、そのエラーを Run のエラーとして返す
+	OnResult func(index int, result ScrapeResult) error
+	// OnError は失敗した企業のエラーを受け取る。指定した場合は失敗した企業のエラーを返さない。
+	// nil を返すと残りの企業の処理を続け、エラーを返すと新しい企業の処理を始めずに終了する
+	OnError func(err RowError) error
+	// OnSkip は対象外のコード (--include-codes / --exclude-codes) のため出力しない企業を受け取る
+	OnSkip func(index int, result ScrapeResult)
+
+	// rows は Companies の代わりに処理する入力ファイルの行 (CLI で使う)
+	rows rowIterator
+	// shuffle は rows を並べ替えてから処理するための乱数 (--shuffle-input)
+	shuffle *rand.Rand
+	// ramp は最初のワーカーの開始をずらす (--ramp-up)
+	ramp *workerRamp
+}
+
+// RowError は Run で 1 企業分の処理に失敗したエラー
+type RowError struct {
+	// RunOptions.Companies での位置 (1 始まり)。CLI の出力の index と同じ
+	Index int
+	// 企業名
+	CompanyName string
+	// 株価の取得に失敗する前に分かった証券コード (分からなかった場合は空)
+	StockCode string
+	Err       error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("%d: %s: %v", e.Index, e.CompanyName, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// Run は opts.Companies の株価を取得し、結果と失敗した企業のエラーをファイルに書き出さずに返す。
+// 結果は Companies の順番に並べ、失敗した企業と対象外のコード (--include-codes / --exclude-codes) の企業は含めない。
+// ctx がキャンセルされた場合は新しい企業の処理を始めず、それまでの結果と ctx のエラーを返す。
+// CLI もこの Run で入力ファイルの各行を処理し、OnResult で出力ファイルに書き出す。
+//
+// リクエストは Source の Scraper の設定 (リトライやリクエストの間隔、Verbose など) に従い、
+// CLI のフラグやパッケージの設定には依存しない。
+// Accept・OnResult・OnError・OnSkip は同時に呼び出されないため、呼び出す側で排他制御する必要はない。
+func Run(ctx context.Context, opts RunOptions) ([]ScrapeResult, []RowError, error) {
+	source := opts.Source
+	if source == nil {
+		source = NewScraper()
+	}
+	// 配当などの付加情報は株価と同じ設定で日経のサイトから取得する
+	scraper := scraperOf(source)
+	log := opts.Logger
+	if log == nil {
+		log = scraper.log()
+	}
+	rows := opts.rows
+	if rows == nil {
+		companies := make([]inputRow, len(opts.Companies))
+		for i, company := range opts.Companies {
+			companies[i] = inputRow{number: i + 1, companyName: company.Name, fallback: company.Fallback}
+		}
+		rows = sliceRows(companies)
+	}
+	// --concurrency 1 の場合は goroutine を使わずに 1 企業ずつ順番に処理する
+	var sem *semaphore.Weighted
+	if opts.Concurrency > 1 {
+		sem = semaphore.NewWeighted(opts.Concurrency)
+	}
+
+	type indexedResult struct {
+		index  int
+		result ScrapeResult
+	}
+	var (
+		// フックの呼び出しと結果の追加は複数の goroutine から行われるため排他制御する
+		mu      sync.Mutex
+		results []indexedResult
+		rowErrs []RowError
+	)
+	accept := func(index int, result ScrapeResult) bool {
+		if opts.Accept == nil {
+			return true
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return opts.Accept(index, result)
+	}
+	err := dispatchRows(ctx, sem, rows, opts.shuffle, func(index int, companyName, fallback string) error {
+		if sem != nil {
+			opts.ramp.wait(ctx)
+		}
+		result, accepted, err := runCompany(ctx, source, scraper, log, index, Company{Name: companyName, Fallback: fallback}, opts, accept)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, errCodeFiltered):
+			log.Printf("%d: %s (%s) は対象外のコードのため出力しません", index, companyName, result.StockCode)
+			if opts.OnSkip != nil {
+				opts.OnSkip(index, result)
+			}
+			return nil
+		case err != nil:
+			rowErr := RowError{Index: index, CompanyName: companyName, StockCode: result.StockCode, Err: err}
+			if opts.OnError != nil {
+				return opts.OnError(rowErr)
+			}
+			rowErrs = append(rowErrs, rowErr)
+			return nil
+		case !accepted:
+			return nil
+		case opts.OnResult != nil:
+			return opts.OnResult(index, result)
+		}
+		results = append(results, indexedResult{index: index, result: result})
+		return nil
+	})
+
+	// 同時に処理した企業の結果とエラーも Companies の順番に並べる
+	sort.Slice(results, func(i, j int) bool { return results[i].index < results[j].index })
+	sort.Slice(rowErrs, func(i, j int) bool { return rowErrs[i].Index < rowErrs[j].Index })
+	var out []ScrapeResult
+	for _, r := range results {
+		out = append(out, r.result)
+	}
+	return out, rowErrs, err
+}
+
+// runCompany は 1 企業分の株価を source から取得し、accept が true を返した場合は付加情報も scraper で取得する。
+// 処理のログは log に出力し、パニックが発生した場合もその企業だけのエラーにする。
+func runCompany(ctx context.Context, source PriceSource, scraper *Scraper, log Logger, index int, company Company, opts RunOptions, accept func(index int, result ScrapeResult) bool) (result ScrapeResult, accepted bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			log.Printf("%d: %s の処理中にパニックが発生しました: %v\n%s", index, company.Name, r, stack)
+			accepted, err = false, &panicError{value: r, stack: stack}
+		}
+	}()
+
+	logFieldsTo(log, "info", logFields{Company: company.Name, Index: &index}, "%d: %s", index, company.Name)
+	start := time.Now()
+	if scraper.Verbose {
+		defer func() {
+			d := time.Since(start)
+			log.Printf("%d: %s の処理に %s かかりました", index, company.Name, d.Round(time.Millisecond))
+			scraper.timings.record("company", d)
+		}()
+	}
+	result, err = source.FetchPrices(ctx, company.Name, company.Fallback)
+	result.Index = index
+	if errors.Is(err, ErrCompanyNotFound) {
+		// 見つからなかった企業もコードを空にした結果として出力する
+		log.Printf("該当する企業が見つかりませんでした: %s", company.Name)
+		result.StockCode = ""
+		err = nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	// 項目を付けられるロガー (--log-format json) の場合は、取得にかかった時間も記録する
+	if _, ok := log.(fieldLogger); ok {
+		logFieldsTo(log, "info", logFields{Company: company.Name, Index: &index, URL: result.SourceURL, Duration: time.Since(start)}, "%d: %s の株価を取得しました", index, company.Name)
+	}
+	if !accept(index, result) {
+		return result, false, nil
+	}
+	scraper.fetchExtras(ctx, company.Name, &result, opts.WithDividends, opts.WithMetadata, opts.WithIndexMembership, opts.WithCurrentPrice)
+	return result, true, nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"math/rand"
+)
+
+// sampleRow は --sample で選ばれた行 (入力ファイルの番号と行番号) を表す。
+type sampleRow struct {
+	file, line int
+}
+
+// sampleRows はすべての入力ファイルのデータ行から n 行を無作為に選ぶ。
+// 同じ seed を指定すれば同じ行が選ばれる。データ行が n 行以下の場合はすべての行を選ぶ。
+func sampleRows(srcs []inputSource, read inputReader, n int, seed int64) (map[sampleRow]bool, error) {
+	// 読み飛ばす行の判定を揃えるため、実際の処理と同じ形式の read で行を数える。
+	// 警告が重複しないよう、read にはログを出力しないもの (discardLogger) を渡す
+	var rows []sampleRow
+	for i, src := range srcs {
+		i := i
+		err := readSource(src, read, func(next rowIterator) error {
+			for {
+				row, ok, err := next()
+				if err != nil || !ok {
+					return err
+				}
+				rows = append(rows, sampleRow{file: i, line: row.number})
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selected := make(map[sampleRow]bool, n)
+	for _, j := range rand.New(rand.NewSource(seed)).Perm(len(rows)) {
+		if len(selected) >= n {
+			break
+		}
+		selected[rows[j]] = true
+	}
+	return selected, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// savedCode は --save-codes に書き出す、企業名とそのコードの対応
+type savedCode struct {
+	// 入力ファイルの番号 (--input に指定した順) と行番号。書き出す順番に使う
+	file, line int
+
+	Name string `json:"name"`
+	// 見つからなかった場合は空
+	Code  string `json:"code"`
+	Found bool   `json:"found"`
+}
+
+// savedCodes は --save-codes に書き出す企業名とコードの対応を集める。
+type savedCodes struct {
+	mu    sync.Mutex
+	codes []savedCode
+}
+
+func (s *savedCodes) add(code savedCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = append(s.codes, code)
+}
+
+// write は企業名とコードの対応を入力ファイルでの順番に path に書き出す。同じ企業名は最初の 1 件のみ書き出す。
+// 拡張子が .json の場合は --input-format json で読み込める JSON の配列、それ以外の場合は
+// 企業名・コード・結果の csv (--fallback-column 2 や --no-search --code-column 2 で読み込める) にする。
+func (s *savedCodes) write(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.codes, func(i, j int) bool {
+		if s.codes[i].file != s.codes[j].file {
+			return s.codes[i].file < s.codes[j].file
+		}
+		return s.codes[i].line < s.codes[j].line
+	})
+	codes := make([]savedCode, 0, len(s.codes))
+	seen := map[string]bool{}
+	for _, code := range s.codes {
+		if seen[code.Name] {
+			continue
+		}
+		seen[code.Name] = true
+		codes = append(codes, code)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(codes); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"企業名", "コード", "結果"}); err != nil {
+		f.Close()
+		return err
+	}
+	for _, code := range codes {
+		status := "見つかった"
+		if !code.Found {
+			status = "見つからない"
+		}
+		if err := w.Write([]string{code.Name, code.Code, status}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
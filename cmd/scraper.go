@@ -0,0 +1,372 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// defaultBaseURL は日経のサイトの URL
+const defaultBaseURL = "https://www.nikkei.com"
+
+// Scraper は日経のサイトから企業のコードと株価を取得する際の設定を保持する。
+// リトライやリクエストの間隔、キャッシュ、robots.txt の確認などもこの設定に従い、
+// CLI では実行ごとに 1 つの Scraper をフラグから作ってすべてのリクエストに使う。
+type Scraper struct {
+	// 株価のページや検索結果へのリクエストに使う HTTP クライアント
+	Client *http.Client
+	// 検索結果のリダイレクト先を確認するための、リダイレクトを自動で追わない HTTP クライアント
+	NoRedirectClient *http.Client
+	// 日経のサイトの URL (末尾の / は付けない)
+	BaseURL string
+	// 日経の検索に追加するクエリパラメータ (--search-param)
+	SearchParams url.Values
+	// 株価を取得する単位 (granularityYear または granularityMonth)
+	Granularity string
+	// 日経の検索を使わず、fallback のコードをそのまま使うかどうか (--no-search)
+	NoSearch bool
+	// 検索結果の候補が複数ある場合に選んでもらうかどうか (--interactive)
+	Interactive bool
+	// 株価のページを取得せず、コードだけを調べるかどうか (--no-history)
+	NoHistory bool
+	// 検索結果が空だった場合に検索し直す最大回数 (--retry-empty)
+	RetryEmpty int
+	// 見つからなかった企業名を、株式会社の有無や全角・半角を変えて検索し直すかどうか (--normalize-company-suffix)
+	NormalizeSuffix bool
+	// 検索や株価の取得のログの出力先。nil の場合はパッケージのロガー (SetLogger) を使う
+	Logger Logger
+
+	// 失敗したリクエストをリトライする最大回数 (--retries)
+	Retries int
+	// タイムアウトや接続の失敗をリトライする最大回数 (--timeout-retries)。-1 の場合は Retries を使う
+	TimeoutRetries int
+	// この Scraper でリトライできる回数の合計の上限 (--retry-budget)。0 の場合は無制限
+	RetryBudget int64
+	// リトライの間隔 (--backoff-*)
+	Backoff BackoffPolicy
+	// 各ページの 1 回の取得にかける時間の上限 (--per-request-timeout)。0 の場合は制限しない
+	RequestTimeout time.Duration
+	// レスポンスの本文として読み込むバイト数の上限 (--max-request-bytes)。0 の場合は無制限
+	MaxResponseBytes int64
+	// 各リクエストの後に待機する最小時間 (--min-delay)
+	MinDelay time.Duration
+	// リクエストごとの所要時間をログに出力して集計するかどうか (--verbose)
+	Verbose bool
+
+	// 年ごとの株価を取得する表の見出し (--history-section)。空の場合は defaultHistorySection を使う
+	HistorySection string
+	// 年間高安の表から追加で取得する値の見出し (--fields)
+	Fields []string
+	// 終値が 0 の年を解析の失敗として扱うかどうか (--zero-is-error)
+	ZeroIsError bool
+	// 終値のセルの解析前の文字列を ScrapeResult.RawPrices に残すかどうか (--with-raw-prices)
+	KeepRawPrices bool
+
+	// 以下は実行中に状態が変わるため CLI のフラグから RunE で作る。nil の場合はそれぞれ使わない
+	// --adaptive-delay の待ち時間の調整
+	adaptive *adaptiveDelay
+	// --http-cache-dir のキャッシュ
+	cache *responseCache
+	// --respect-robots で読み込んだ robots.txt のルール
+	robots *robotsRules
+	// --workers-per-host の制限
+	hostLimits *hostLimiter
+	// --metrics-file のリクエストの所要時間
+	metrics *requestHistogram
+	// リトライした回数 (NewScraper で作る)
+	retries *retryCounter
+	// --verbose の所要時間の集計 (NewScraper で作る)
+	timings *timingStats
+}
+
+// NewScraper は既定の設定 (年ごとの株価、パッケージの HTTP クライアント、フラグの既定値) の Scraper を作る。
+func NewScraper() *Scraper {
+	return &Scraper{
+		Client:           httpClient,
+		NoRedirectClient: noRedirectClient,
+		BaseURL:          defaultBaseURL,
+		SearchParams:     url.Values{},
+		Granularity:      granularityYear,
+		TimeoutRetries:   -1,
+		Backoff:          defaultBackoff,
+		MaxResponseBytes: defaultMaxResponseBytes,
+		retries:          &retryCounter{},
+		timings:          newTimingStats(),
+	}
+}
+
+// log は Logger を返す。nil の場合はパッケージのロガーを返す。
+func (s *Scraper) log() Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return logger
+}
+
+// logf は Logger にログを出力する。
+func (s *Scraper) logf(format string, v ...interface{}) {
+	s.log().Printf(format, v...)
+}
+
+// LookupCode は日経の検索で企業名 (またはコード) から証券コードを調べる。見つからなかった場合は ErrCompanyNotFound を返す。
+// NormalizeSuffix の場合は、見つからなかった企業名を companyNameVariants の候補で順に検索し直す。
+func (s *Scraper) LookupCode(ctx context.Context, companyName string) (string, error) {
+	// --interactive で以前に選んだ企業はそのまま使う
+	if s.Interactive {
+		if code, ok := rememberedChoice(companyName); ok {
+			if code == "" {
+				return "", ErrCompanyNotFound
+			}
+			return code, nil
+		}
+	}
+	code, err := s.lookupCodeRetry(ctx, companyName)
+	if !s.NormalizeSuffix || !errors.Is(err, ErrCompanyNotFound) {
+		return code, err
+	}
+	for _, variant := range companyNameVariants(companyName) {
+		code, err = s.lookupCodeRetry(ctx, variant)
+		if err == nil {
+			s.logf("%s は %s として検索して見つかりました: %s (--normalize-company-suffix)", companyName, variant, code)
+			return code, nil
+		}
+		if !errors.Is(err, ErrCompanyNotFound) {
+			return "", err
+		}
+	}
+	return "", ErrCompanyNotFound
+}
+
+// lookupCodeRetry は企業名 (またはコード) で日経の検索を行う。
+// 検索結果のページが途中までしか返らず候補が空になることがあるため、RetryEmpty の回数まで Backoff の間隔を空けて検索し直す。
+func (s *Scraper) lookupCodeRetry(ctx context.Context, companyName string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		code, err := s.lookupCode(ctx, companyName)
+		if !errors.Is(err, ErrCompanyNotFound) || attempt >= s.RetryEmpty || !s.takeRetry() {
+			if err == nil && attempt > 0 {
+				s.logf("%s は %d 回目の再検索で見つかりました (--retry-empty)", companyName, attempt)
+			}
+			return code, err
+		}
+		delay := s.Backoff.delay(attempt)
+		s.logf("%s の検索結果が空だったため、%s 後にもう一度検索します (%d/%d 回目, --retry-empty)", companyName, delay.Round(time.Millisecond), attempt+1, s.RetryEmpty)
+		if !sleepContext(ctx, delay) {
+			return "", ctx.Err()
+		}
+	}
+}
+
+// lookupCode は日経の検索を 1 回だけ行い、企業名 (またはコード) から証券コードを調べる。
+func (s *Scraper) lookupCode(ctx context.Context, companyName string) (string, error) {
+	defer s.waitMinDelay(ctx)
+	searchURL := fmt.Sprintf("%s/nkd/search?searchKeyword=%s", s.BaseURL, url.QueryEscape(companyName))
+	if len(s.SearchParams) > 0 {
+		searchURL += "&" + s.SearchParams.Encode()
+	}
+	if err := s.checkRobots(searchURL); err != nil {
+		return "", err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.NoRedirectClient, searchURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// 検索結果が 1 件の場合は企業ページへリダイレクトされるので、リダイレクト先の scode を使う
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		location, err := resp.Location()
+		if err != nil {
+			return "", fmt.Errorf("日経のサイトのリダイレクト先が不正です: %w", err)
+		}
+		if code := normalizeStockCode(location.Query().Get("scode")); code != "" {
+			return code, nil
+		}
+		// scode を含まないリダイレクト先は、そのページを検索結果として解析する
+		if err := s.checkRobots(location.String()); err != nil {
+			return "", err
+		}
+		resp, err = s.httpGet(reqCtx, s.Client, location.String())
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+	}
+
+	if resp.StatusCode != 200 {
+		return "", statusError(resp)
+	}
+	code := normalizeStockCode(resp.Request.URL.Query().Get("scode"))
+	if code != "" {
+		return code, nil
+	}
+
+	doc, err := parseDocument(resp, "search_"+companyName)
+	if err != nil {
+		return "", err
+	}
+	if isBlockPage(doc) {
+		return "", ErrBlocked
+	}
+	// 検索結果の候補のうち企業名が完全に一致するもの
+	var candidates, exact []companyCandidate
+	var parseErr error
+	doc.Find(".m-companyList_item_data_name").EachWithBreak(func(i int, item *goquery.Selection) bool {
+		name := strings.TrimSpace(item.Text())
+		href, exists := item.Attr("href")
+		if !exists {
+			return true
+		}
+		u, err := url.Parse(href)
+		if err != nil {
+			parseErr = fmt.Errorf("検索結果のリンクが不正です: %w", err)
+			return false
+		}
+		candidate := companyCandidate{Name: name, Code: normalizeStockCode(u.Query().Get("scode"))}
+		candidates = append(candidates, candidate)
+		if name == companyName {
+			exact = append(exact, candidate)
+		}
+		return true
+	})
+	if parseErr != nil {
+		return "", parseErr
+	}
+
+	switch {
+	case len(exact) == 1 || (len(exact) > 1 && !s.Interactive):
+		code = exact[0].Code
+	case len(exact) > 1:
+		// 同じ名前の企業が複数ある場合は選んでもらう
+		code, err = chooseCandidate(companyName, exact)
+	case len(candidates) > 0 && s.Interactive:
+		code, err = chooseCandidate(companyName, candidates)
+	}
+	if err != nil {
+		return "", err
+	}
+	if code == "" {
+		return "", ErrCompanyNotFound
+	}
+	return code, nil
+}
+
+// FetchPrices は企業の株価を取得する。企業名で見つからなかった場合、fallback が空でなければ
+// fallback (証券コードなど) でも検索する。どちらでも見つからなかった場合は ErrCompanyNotFound を返す。
+func (s *Scraper) FetchPrices(ctx context.Context, companyName, fallback string) (ScrapeResult, error) {
+	result := newScrapeResult(companyName)
+
+	code := ""
+	if s.NoSearch {
+		// コードが正しいことが分かっている入力のため、企業名での検索には切り替えない
+		code = normalizeStockCode(fallback)
+		if !stockCodePattern.MatchString(code) {
+			return result, fmt.Errorf("%w: %q", ErrInvalidStockCode, fallback)
+		}
+	}
+	if code == "" && companyName != "" {
+		var err error
+		code, err = s.LookupCode(ctx, companyName)
+		if err != nil && !errors.Is(err, ErrCompanyNotFound) {
+			return result, err
+		}
+		if code != "" && fallback != "" {
+			s.logf("%s は企業名で見つかりました: %s", companyName, code)
+		}
+	}
+	if code == "" && fallback != "" {
+		var err error
+		code, err = s.LookupCode(ctx, fallback)
+		if err != nil && !errors.Is(err, ErrCompanyNotFound) {
+			return result, err
+		}
+		if code != "" {
+			s.logf("%s は企業名では見つからず %s で見つかりました: %s", companyName, fallback, code)
+		}
+	}
+	if code == "" {
+		return result, ErrCompanyNotFound
+	}
+	result.StockCode = code
+	// 企業名で検索できるよう、コードでの絞り込みはコードが分かった後に行う
+	if !codeAllowed(code) {
+		return result, errCodeFiltered
+	}
+	if s.NoHistory {
+		return result, nil
+	}
+
+	defer s.waitMinDelay(ctx)
+	// search https://www.nikkei.com/nkd/company/history/yprice/?scode=8304
+	page := "yprice"
+	if s.Granularity == granularityMonth {
+		page = "mprice"
+	}
+	result.SourceURL = fmt.Sprintf("%s/nkd/company/history/%s?scode=%s", s.BaseURL, page, url.QueryEscape(code))
+	result.FetchedAt = time.Now()
+	if err := s.checkRobots(result.SourceURL); err != nil {
+		return result, err
+	}
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, result.SourceURL)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return result, statusError(resp)
+	}
+
+	doc, err := parseDocument(resp, code)
+	if err != nil {
+		return result, err
+	}
+	err = s.parsePricePage(doc, &result)
+	return result, err
+}
+
+// parsePricePage は株価のページ (年間高安または月間高安) から株価と PER などを result に取得する。
+// 日経のサイトから取得したページと、parse サブコマンドで読み込んだ保存済みのページの両方に使う。
+func (s *Scraper) parsePricePage(doc *goquery.Document, result *ScrapeResult) error {
+	if isBlockPage(doc) {
+		return ErrBlocked
+	}
+	if s.Granularity == granularityMonth {
+		parseMonthlyPrices(doc, result)
+	} else {
+		s.parseYearlyPrices(doc, result)
+		if err := s.checkZeroPrices(*result); err != nil {
+			return err
+		}
+		s.checkSplits(doc, result)
+		if len(result.SplitSuspectYears) > 0 {
+			s.logf("%s (%s) は %s 年の終値が前年から %s 倍以上に変化しています。株式分割が調整されていない可能性があるため確認してください", result.CompanyName, result.StockCode, formatYears(result.SplitSuspectYears, ", "), strconv.FormatFloat(splitWarnRatio, 'f', -1, 64))
+		}
+	}
+	parseValuation(doc, result)
+	return nil
+}
+
+// newScrapeResult は年ごとの値などを格納する map を初期化した ScrapeResult を返す。
+func newScrapeResult(companyName string) ScrapeResult {
+	return ScrapeResult{
+		CompanyName:   companyName,
+		Prices:        map[int]float64{},
+		Opens:         map[int]float64{},
+		Volumes:       map[int]float64{},
+		Dividends:     map[int]float64{},
+		MonthlyPrices: map[string]float64{},
+	}
+}
@@ -0,0 +1,274 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// newTestScraper は handler を日経のサイトの代わりに使う Scraper を作る。
+func newTestScraper(t *testing.T, handler http.Handler) *Scraper {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	s := NewScraper()
+	s.BaseURL = server.URL
+	s.Client = server.Client()
+	noRedirect := *server.Client()
+	noRedirect.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	s.NoRedirectClient = &noRedirect
+	return s
+}
+
+// emptySearchPage は候補が 1 件も無い検索結果のページ
+const emptySearchPage = `<html><head><title>検索結果</title></head><body><ul class="m-companyList"></ul></body></html>`
+
+func TestFetchPricesNotFound(t *testing.T) {
+	s := newTestScraper(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(emptySearchPage))
+	}))
+
+	result, err := s.FetchPrices(context.Background(), "存在しない株式会社", "")
+	if !errors.Is(err, ErrCompanyNotFound) {
+		t.Fatalf("FetchPrices() error = %v, want ErrCompanyNotFound", err)
+	}
+	if result.CompanyName != "存在しない株式会社" || result.StockCode != "" {
+		t.Errorf("FetchPrices() = {CompanyName: %q, StockCode: %q}, want the company name without a code", result.CompanyName, result.StockCode)
+	}
+}
+
+func TestFetchPricesHTTPStatus(t *testing.T) {
+	s := newTestScraper(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<html><head><title>メンテナンス中</title></head></html>`))
+	}))
+
+	_, err := s.FetchPrices(context.Background(), "トヨタ自動車", "")
+	if !errors.Is(err, ErrHTTPStatus) {
+		t.Fatalf("FetchPrices() error = %v, want ErrHTTPStatus", err)
+	}
+	if errors.Is(err, ErrCompanyNotFound) {
+		t.Errorf("FetchPrices() error = %v, should not be ErrCompanyNotFound", err)
+	}
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("FetchPrices() error = %v, want *HTTPStatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want %d", statusErr.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRunNotFoundRow(t *testing.T) {
+	s := newTestScraper(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(emptySearchPage))
+	}))
+
+	results, rowErrs, err := Run(context.Background(), RunOptions{
+		Companies: []Company{{Name: "存在しない株式会社"}},
+		Source:    s,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(rowErrs) != 0 {
+		t.Fatalf("Run() row errors = %v, want none", rowErrs)
+	}
+	if len(results) != 1 || results[0].StockCode != "" {
+		t.Fatalf("Run() results = %+v, want one result without a code", results)
+	}
+}
+
+func TestLookupCode(t *testing.T) {
+	// searchList はリダイレクト先の scode を含まない検索結果のページ
+	const searchList = `<html><head><title>検索結果</title></head><body><ul class="m-companyList">` +
+		`<li class="m-companyList_item"><a class="m-companyList_item_data_name" href="/nkd/company/?scode=6758">ソニーグループ</a></li>` +
+		`</ul></body></html>`
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "redirect with scode",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/nkd/search" {
+					t.Errorf("unexpected request to %s", r.URL)
+				}
+				http.Redirect(w, r, "/nkd/company/?scode=6758", http.StatusFound)
+			},
+		},
+		{
+			name: "redirect without scode",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/nkd/search" {
+					http.Redirect(w, r, "/nkd/search/list", http.StatusFound)
+					return
+				}
+				w.Write([]byte(searchList))
+			},
+		},
+		{
+			name: "no redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(searchList))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScraper(t, tt.handler)
+			code, err := s.lookupCode(context.Background(), "ソニーグループ")
+			if err != nil {
+				t.Fatalf("lookupCode() error = %v", err)
+			}
+			if code != "6758" {
+				t.Errorf("lookupCode() = %q, want 6758", code)
+			}
+		})
+	}
+}
+
+// readTestdata はリポジトリの testdata にあるファイルを読み込む。
+func readTestdata(tb testing.TB, name string) []byte {
+	tb.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "testdata", filepath.FromSlash(name)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// parseTestPage は testdata に保存した株価のページを parsePricePage で解析する。
+func parseTestPage(tb testing.TB, name string) ScrapeResult {
+	tb.Helper()
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(readTestdata(tb, name)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	result := newScrapeResult("トヨタ自動車")
+	result.StockCode = "7203"
+	s := NewScraper()
+	s.Logger = discardLogger{}
+	if err := s.parsePricePage(doc, &result); err != nil {
+		tb.Fatalf("parsePricePage(%s) error = %v", name, err)
+	}
+	return result
+}
+
+// ypriceCloses は testdata/yprice/7203.html の年ごとの終値
+var ypriceCloses = map[int]float64{
+	2013: 1284, 2014: 1576, 2015: 1491, 2016: 1383, 2017: 1442,
+	2018: 1302, 2019: 1544, 2020: 1627, 2021: 2116, 2022: 1803,
+}
+
+// checkYpriceCloses は result の終値が ypriceCloses と一致するかを確認する。
+func checkYpriceCloses(t *testing.T, result ScrapeResult) {
+	t.Helper()
+	if len(result.Prices) != len(ypriceCloses) {
+		t.Errorf("Prices = %v, want %v", result.Prices, ypriceCloses)
+	}
+	for year, want := range ypriceCloses {
+		if got, ok := result.Prices[year]; !ok || got != want {
+			t.Errorf("Prices[%d] = %v (present: %v), want %v", year, got, ok, want)
+		}
+	}
+}
+
+func TestParsePricePage(t *testing.T) {
+	result := parseTestPage(t, "yprice/7203.html")
+
+	checkYpriceCloses(t, result)
+	if result.Opens[2013] != 1111 || result.Opens[2022] != 2094 {
+		t.Errorf("Opens = %v", result.Opens)
+	}
+	if result.Volumes[2013] != 14321098700 || result.Volumes[2022] != 9876543200 {
+		t.Errorf("Volumes = %v", result.Volumes)
+	}
+	if result.HighDates[2022] != "2022-01-17" || result.LowDates[2016] != "2016-06-24" {
+		t.Errorf("HighDates = %v, LowDates = %v", result.HighDates, result.LowDates)
+	}
+	if result.PeriodHigh == nil || *result.PeriodHigh != 2475 || result.PeriodLow == nil || *result.PeriodLow != 1010 {
+		t.Errorf("PeriodHigh = %v, PeriodLow = %v, want 2475 and 1010", result.PeriodHigh, result.PeriodLow)
+	}
+	if result.PER == nil || *result.PER != 9.61 || result.PBR == nil || *result.PBR != 0.94 || result.MarketCap == nil || *result.MarketCap != 29418000 {
+		t.Errorf("PER = %v, PBR = %v, MarketCap = %v", result.PER, result.PBR, result.MarketCap)
+	}
+	if len(result.SplitSuspectYears) != 0 {
+		t.Errorf("SplitSuspectYears = %v, want none", result.SplitSuspectYears)
+	}
+}
+
+// BenchmarkSearchPastStock は保存した年間高安のページ (testdata/yprice/7203.html) から株価を取得する処理を測る。
+// ページの取得は含めず、HTML の解析と表の読み取りにかかる時間を測る。
+func BenchmarkSearchPastStock(b *testing.B) {
+	page := readTestdata(b, "yprice/7203.html")
+	s := NewScraper()
+	s.Logger = discardLogger{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+		if err != nil {
+			b.Fatal(err)
+		}
+		result := newScrapeResult("トヨタ自動車")
+		if err := s.parsePricePage(doc, &result); err != nil {
+			b.Fatal(err)
+		}
+		if len(result.Prices) != len(ypriceCloses) {
+			b.Fatalf("got %d prices, want %d", len(result.Prices), len(ypriceCloses))
+		}
+	}
+}
+
+func TestFetchPricesAlphanumericCode(t *testing.T) {
+	page := readTestdata(t, "yprice/7203.html")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/nkd/search" && r.URL.Query().Get("searchKeyword") == "130a":
+			http.Redirect(w, r, "/nkd/company/?scode=130A", http.StatusFound)
+		case r.URL.Path == "/nkd/search":
+			w.Write([]byte(emptySearchPage))
+		case r.URL.Path == "/nkd/company/history/yprice" && r.URL.Query().Get("scode") == "130A":
+			w.Write(page)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	tests := []struct {
+		name     string
+		noSearch bool
+		fallback string
+	}{
+		{name: "search", fallback: "130a"},
+		{name: "no search", noSearch: true, fallback: "１３０ａ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScraper(t, handler)
+			s.Logger = discardLogger{}
+			s.NoSearch = tt.noSearch
+			result, err := s.FetchPrices(context.Background(), "存在しない株式会社", tt.fallback)
+			if err != nil {
+				t.Fatalf("FetchPrices() error = %v", err)
+			}
+			if result.StockCode != "130A" {
+				t.Errorf("StockCode = %q, want 130A", result.StockCode)
+			}
+			checkYpriceCloses(t, result)
+		})
+	}
+}
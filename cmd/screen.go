@@ -0,0 +1,61 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minPrice は --min-price で指定された、ある年の終値の下限
+type minPrice struct {
+	year  int
+	price float64
+}
+
+// minPrices は出力する企業の条件 (--min-price)。空の場合は絞り込まない
+var minPrices []minPrice
+
+// parseMinPrices は --min-price に指定された year:value の形式の値を解析する。
+func parseMinPrices(values []string) ([]minPrice, error) {
+	conditions := make([]minPrice, 0, len(values))
+	for _, value := range values {
+		yearText, priceText, found := strings.Cut(value, ":")
+		if !found {
+			return nil, fmt.Errorf("--min-price は 年:終値 の形式で指定してください: %s", value)
+		}
+		year, err := strconv.Atoi(strings.TrimSpace(yearText))
+		if err != nil || !isTargetYear(year) {
+			return nil, fmt.Errorf("--min-price の年には %d 年から %d 年までの年を指定してください: %s", targetYears[0], targetYears[len(targetYears)-1], value)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceText), 64)
+		if err != nil {
+			return nil, fmt.Errorf("--min-price の終値には数値を指定してください: %s", value)
+		}
+		conditions = append(conditions, minPrice{year: year, price: price})
+	}
+	return conditions, nil
+}
+
+// isTargetYear は year が出力対象の年かどうかを返す。
+func isTargetYear(year int) bool {
+	for _, y := range targetYears {
+		if y == year {
+			return true
+		}
+	}
+	return false
+}
+
+// failedMinPrice は result が満たさない --min-price の条件を返す。すべて満たす場合は ok に true を返す。
+// 条件の年の終値を取得できなかった企業は条件を満たさないものとして扱う。
+func failedMinPrice(result ScrapeResult) (failed minPrice, ok bool) {
+	for _, condition := range minPrices {
+		if price, found := result.Prices[condition.year]; !found || price < condition.price {
+			return condition, false
+		}
+	}
+	return minPrice{}, true
+}
@@ -0,0 +1,137 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PriceSource は企業の株価の取得元。出力の形式は取得元によらず ScrapeResult にそろえる。
+type PriceSource interface {
+	// Name はログに出力する取得元の名前を返す
+	Name() string
+	// FetchPrices は企業の株価を取得する。fallback は企業名で見つからなかった場合に使うコードなど。
+	// 企業が見つからなかった場合は ErrCompanyNotFound を返す
+	FetchPrices(ctx context.Context, companyName, fallback string) (ScrapeResult, error)
+}
+
+// Name は日経のサイトから取得することを表す名前を返す。
+func (s *Scraper) Name() string {
+	return "nikkei"
+}
+
+// scraperOf は source が日経のサイトから取得する場合はその Scraper を返し、それ以外の場合は NewScraper の Scraper を返す。
+// 配当や会社概要などの付加情報は、取得元によらず日経のサイトから取得するために使う。
+func scraperOf(source PriceSource) *Scraper {
+	switch s := source.(type) {
+	case *Scraper:
+		return s
+	case fallbackSource:
+		return scraperOf(s.primary)
+	}
+	return NewScraper()
+}
+
+// newPriceSource は --fallback-source に指定された "種類:引数" の形式の取得元を作る。
+func newPriceSource(spec string) (PriceSource, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "ndjson":
+		if arg == "" {
+			return nil, fmt.Errorf("--fallback-source の ndjson にはファイルのパスを指定してください (例: ndjson:./previous.ndjson)")
+		}
+		return loadNdjsonSource(arg)
+	default:
+		return nil, fmt.Errorf("--fallback-source には ndjson:<パス> の形式で取得元を指定してください: %s", spec)
+	}
+}
+
+// fallbackSource は primary で取得に失敗した企業を secondary から取得する (--fallback-source)。
+type fallbackSource struct {
+	primary, secondary PriceSource
+}
+
+func (f fallbackSource) Name() string {
+	return f.primary.Name()
+}
+
+// FetchPrices は primary で取得し、失敗した場合は secondary で取得し直す。
+// secondary でも取得できなかった場合は primary のエラーを返す。
+func (f fallbackSource) FetchPrices(ctx context.Context, companyName, fallback string) (ScrapeResult, error) {
+	result, err := f.primary.FetchPrices(ctx, companyName, fallback)
+	// 見つからなかった企業は取得に失敗したわけではないため、secondary では取得し直さない
+	if err == nil || errors.Is(err, errCodeFiltered) || errors.Is(err, ErrCompanyNotFound) {
+		return result, err
+	}
+	secondaryResult, secondaryErr := f.secondary.FetchPrices(ctx, companyName, fallback)
+	if secondaryErr != nil {
+		return result, err
+	}
+	logger.Printf("%s は %s で取得できなかったため %s から取得しました: %v", companyName, f.primary.Name(), f.secondary.Name(), err)
+	return secondaryResult, nil
+}
+
+// ndjsonSource は以前に --format ndjson で出力した結果を取得元として使う。
+// 日経のサイトが使えない間も、以前に取得できた企業は前回の値で出力できる。
+type ndjsonSource struct {
+	path string
+	// 企業名とコードごとの、以前に見つかった企業の結果
+	byName, byCode map[string]ScrapeResult
+}
+
+func loadNdjsonSource(path string) (*ndjsonSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("--fallback-source のファイルを開けません: %w", err)
+	}
+	defer f.Close()
+	source := &ndjsonSource{path: path, byName: map[string]ScrapeResult{}, byCode: map[string]ScrapeResult{}}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record ndjsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("--fallback-source のファイルの %d 行目を読み込めません: %s: %w", line, path, err)
+		}
+		// 見つからなかった企業は取得元として使わない
+		if record.StockCode == "" {
+			continue
+		}
+		source.byName[record.CompanyName] = record.ScrapeResult
+		source.byCode[record.StockCode] = record.ScrapeResult
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("--fallback-source のファイルを読み込めません: %s: %w", path, err)
+	}
+	return source, nil
+}
+
+func (n *ndjsonSource) Name() string {
+	return n.path
+}
+
+// FetchPrices は企業名、無ければ fallback のコードで以前の結果を探す。
+func (n *ndjsonSource) FetchPrices(_ context.Context, companyName, fallback string) (ScrapeResult, error) {
+	result, ok := n.byName[companyName]
+	if !ok {
+		result, ok = n.byCode[normalizeStockCode(fallback)]
+	}
+	if !ok {
+		return ScrapeResult{CompanyName: companyName}, ErrCompanyNotFound
+	}
+	if !codeAllowed(result.StockCode) {
+		return result, errCodeFiltered
+	}
+	result.CompanyName = companyName
+	return result, nil
+}
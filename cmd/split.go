@@ -0,0 +1,81 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// splitWarnRatio は前年の終値からこの倍率以上に変化した (または 1/splitWarnRatio 以下になった) 年を、
+// 株式分割が調整されていない疑いのある年として扱う (--split-warn-ratio)。0 の場合は確認しない
+var splitWarnRatio = 3.0
+
+// detectSplitAdjusted は年間高安の表 (findHistoryTable) の周りの注記から、株価が株式分割を調整したものかどうかを判定する。
+// 注記が無く分からない場合は nil を返す。
+func detectSplitAdjusted(table *goquery.Selection) *bool {
+	if table == nil {
+		return nil
+	}
+	note := normalizeHeadline(table.Parent().Text())
+	if !strings.Contains(note, "分割") {
+		return nil
+	}
+	var adjusted bool
+	switch {
+	case strings.Contains(note, "調整前"), strings.Contains(note, "未調整"), strings.Contains(note, "考慮していません"):
+		adjusted = false
+	case strings.Contains(note, "調整"), strings.Contains(note, "考慮"), strings.Contains(note, "修正"):
+		adjusted = true
+	default:
+		return nil
+	}
+	return &adjusted
+}
+
+// suspectSplitYears は終値が前年から splitWarnRatio 倍以上に変化した年を昇順で返す。
+// 前年の終値が無い年は確認しない。
+func suspectSplitYears(result ScrapeResult) []int {
+	if splitWarnRatio <= 0 {
+		return nil
+	}
+	var years []int
+	for i := 1; i < len(targetYears); i++ {
+		prev, okPrev := result.Prices[targetYears[i-1]]
+		cur, ok := result.Prices[targetYears[i]]
+		if !okPrev || !ok || prev <= 0 || cur <= 0 {
+			continue
+		}
+		if ratio := cur / prev; ratio >= splitWarnRatio || ratio <= 1/splitWarnRatio {
+			years = append(years, targetYears[i])
+		}
+	}
+	return years
+}
+
+// checkSplits は株式分割の調整の有無と、調整されていない疑いのある年を result に記録する。
+func (s *Scraper) checkSplits(doc *goquery.Document, result *ScrapeResult) {
+	result.SplitAdjusted = detectSplitAdjusted(s.findHistoryTable(doc))
+	result.SplitSuspectYears = suspectSplitYears(*result)
+}
+
+// formatYears は年の一覧を sep で区切った文字列にする。
+func formatYears(years []int, sep string) string {
+	texts := make([]string, len(years))
+	for i, year := range years {
+		texts[i] = strconv.Itoa(year)
+	}
+	return strings.Join(texts, sep)
+}
+
+// validateSplitWarnRatio は --split-warn-ratio の値を確認する。
+func validateSplitWarnRatio(ratio float64) error {
+	if ratio != 0 && ratio <= 1 {
+		return fmt.Errorf("--split-warn-ratio には 1 より大きい値 (0 の場合は確認しない) を指定してください: %g", ratio)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"strings"
+)
+
+// maxSplitNameWarnings は企業名が分割された疑いのある行を 1 行ずつログに出力する数の上限
+const maxSplitNameWarnings = 5
+
+// splitNameCheck は、カンマを含む企業名がダブルクォートで囲まれておらず、
+// CSV の読み込みで複数の列に分割された疑いのある行を見つけて警告する。
+type splitNameCheck struct {
+	// 警告の出力先
+	log       Logger
+	delimiter rune
+	// ヘッダ行 (ヘッダが無い場合は最初のデータ行) の列数。0 の場合はまだ分からない
+	expected int
+	// 疑いのある行の数
+	suspicious int
+}
+
+// observeHeader はヘッダ行の列数を、各行の列数と比べる基準にする。
+func (c *splitNameCheck) observeHeader(record []string) {
+	c.expected = len(record)
+}
+
+// check はデータ行 record を確認し、企業名が分割された疑いがある場合はログに出力する。
+func (c *splitNameCheck) check(line int, record []string) {
+	if c.expected == 0 {
+		c.expected = len(record)
+		return
+	}
+	reason := ""
+	switch {
+	case len(record) > c.expected:
+		reason = "列の数がヘッダ行より多くなっています"
+	case c.delimiter == ',' && len(record) > 1 && strings.HasPrefix(record[1], " ") && !stockCodePattern.MatchString(normalizeStockCode(record[1])):
+		// "株式会社ABC, DEF" のように、カンマの後に空白を入れた企業名が分割された場合
+		reason = "2 列目が空白から始まっています"
+	default:
+		return
+	}
+	c.suspicious++
+	if c.suspicious <= maxSplitNameWarnings {
+		c.log.Printf("%d: 企業名 %q がカンマで分割されている可能性があります (%s: %q)。企業名にカンマを含む場合はダブルクォートで囲んでください", line, record[0], reason, strings.Join(record, string(c.delimiter)))
+	}
+}
+
+// summary は疑いのある行の件数をログに出力する。
+func (c *splitNameCheck) summary() {
+	if c.suspicious > maxSplitNameWarnings {
+		c.log.Printf("企業名がカンマで分割されている可能性がある行が、ほかに %d 行あります。入力ファイルのダブルクォートの囲み方を確認してください", c.suspicious-maxSplitNameWarnings)
+	}
+}
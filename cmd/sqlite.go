@@ -0,0 +1,116 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS companies (
+	input_file TEXT NOT NULL,
+	idx        INTEGER NOT NULL,
+	name       TEXT NOT NULL,
+	code       TEXT NOT NULL,
+	fetched_at TEXT,
+	source_url TEXT,
+	PRIMARY KEY (input_file, idx)
+);
+CREATE TABLE IF NOT EXISTS prices (
+	code     TEXT NOT NULL,
+	year     INTEGER NOT NULL,
+	close    REAL,
+	volume   REAL,
+	dividend REAL,
+	PRIMARY KEY (code, year)
+);
+`
+
+// sqliteWriter はスクレイピング結果を SQLite のデータベースに書き込む。
+// 書き込みは 1 つのトランザクションで行い、Close で確定する。
+type sqliteWriter struct {
+	db                     *sql.DB
+	tx                     *sql.Tx
+	companyStmt, priceStmt *sql.Stmt
+}
+
+func newSqliteWriter(path string) (*sqliteWriter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteWriter{db: db}, nil
+}
+
+// WriteHeader はテーブルが無ければ作成し、結果を書き込むトランザクションを始める。
+func (s *sqliteWriter) WriteHeader() error {
+	if _, err := s.db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	s.companyStmt, err = tx.Prepare("INSERT OR REPLACE INTO companies (input_file, idx, name, code, fetched_at, source_url) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	s.priceStmt, err = tx.Prepare("INSERT OR REPLACE INTO prices (code, year, close, volume, dividend) VALUES (?, ?, ?, ?, ?)")
+	return err
+}
+
+// WriteResult は 1 企業分の結果を companies と prices に書き込む。
+// 企業が見つからなかった場合は companies にのみ空のコードで記録する。
+func (s *sqliteWriter) WriteResult(result ScrapeResult) error {
+	var fetchedAt, sourceURL interface{}
+	if !result.FetchedAt.IsZero() {
+		fetchedAt = result.FetchedAt.Format(time.RFC3339)
+		sourceURL = result.SourceURL
+	}
+	if _, err := s.companyStmt.Exec(result.InputFile, result.Index, result.CompanyName, result.StockCode, fetchedAt, sourceURL); err != nil {
+		return err
+	}
+	if result.StockCode == "" {
+		return nil
+	}
+	for _, year := range targetYears {
+		price, ok := result.Prices[year]
+		if !ok {
+			continue
+		}
+		var volume interface{}
+		if v, ok := result.Volumes[year]; ok {
+			volume = v
+		}
+		var dividend interface{}
+		if d, ok := result.Dividends[year]; ok {
+			dividend = d
+		}
+		if _, err := s.priceStmt.Exec(result.StockCode, year, price, volume, dividend); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush は何もしない。書き込んだ結果は Close でまとめて確定する。
+func (s *sqliteWriter) flush() error {
+	return nil
+}
+
+// Close はトランザクションを確定してデータベースを閉じる。
+func (s *sqliteWriter) Close() error {
+	if s.tx == nil {
+		return s.db.Close()
+	}
+	if err := s.tx.Commit(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// transposedColumn は --transpose で 1 列になる企業の結果
+type transposedColumn struct {
+	line   int
+	result ScrapeResult
+}
+
+// transposeWriter は年を行、企業を列にした終値の表を CSV として書き込む (--transpose)。
+// 列を揃えるためにすべての結果をメモリに溜め、Close でまとめて書き出す。
+type transposeWriter struct {
+	out     io.WriteCloser
+	opts    outputOptions
+	columns []transposedColumn
+}
+
+func newTransposeWriter(path string, gzipOutput bool, opts outputOptions) (*transposeWriter, error) {
+	out, _, err := createOutputWriter(path, false, gzipOutput)
+	if err != nil {
+		return nil, err
+	}
+	return &transposeWriter{out: out, opts: opts}, nil
+}
+
+// WriteHeader は何もしない。ヘッダ行は企業の列が揃ってから Close でまとめて書き出す。
+func (t *transposeWriter) WriteHeader() error {
+	return nil
+}
+
+func (t *transposeWriter) WriteResult(result ScrapeResult) error {
+	// すべての結果をメモリに溜めるため、--max-rows を超える企業は溜めない
+	if t.opts.TransposeLimit > 0 && len(t.columns) >= t.opts.TransposeLimit {
+		return fmt.Errorf("--transpose で列にする企業の数が --max-rows の %d 件を超えました", t.opts.TransposeLimit)
+	}
+	t.columns = append(t.columns, transposedColumn{line: result.Index, result: result})
+	return nil
+}
+
+// flush は何もしない。企業の列がすべて揃うまで書き出せないため、Close でまとめて書き出す。
+func (t *transposeWriter) flush() error {
+	return nil
+}
+
+func (t *transposeWriter) Close() error {
+	w := csv.NewWriter(t.out)
+	err := t.writeTable(w)
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if closeErr := t.out.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeTable は入力ファイルの順番に並べた企業を列にして、対象の年ごとの行を書き込む。
+func (t *transposeWriter) writeTable(w *csv.Writer) error {
+	sort.SliceStable(t.columns, func(i, j int) bool { return t.columns[i].line < t.columns[j].line })
+	if !t.opts.WithoutHeader {
+		header := []string{localizeColumn(t.opts.Lang, "年")}
+		for _, column := range t.columns {
+			header = append(header, column.result.CompanyName)
+		}
+		if err := w.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, year := range t.opts.years() {
+		record := []string{strconv.Itoa(year)}
+		for _, column := range t.columns {
+			// 見つからなかった企業の株価は 0 と区別できるよう、指定された値に置き換える
+			if column.result.StockCode == "" && t.opts.NotFoundValue != nil {
+				record = append(record, *t.opts.NotFoundValue)
+				continue
+			}
+			record = append(record, t.opts.formatClose(column.result, year))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validationErrors はスクレイピングを始める前に見つかった入力内容の誤りをまとめて保持する。
+type validationErrors []string
+
+func (v *validationErrors) add(err error) {
+	*v = append(*v, err.Error())
+}
+
+func (v *validationErrors) addf(format string, args ...interface{}) {
+	*v = append(*v, fmt.Sprintf(format, args...))
+}
+
+// err は誤りが 1 つ以上ある場合に、すべての誤りを並べたエラーを返す。
+func (v validationErrors) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return fmt.Errorf("指定された内容に誤りがあります:\n  - %s", strings.Join(v, "\n  - "))
+}
+
+// checkReadable は path のファイルが読み込めるかどうかを確認する。
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("入力ファイルを開けません: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("入力ファイルにディレクトリが指定されています: %s", path)
+	}
+	return nil
+}
+
+// checkWritable は path に出力ファイルを書き込めるかどうかを確認する。
+// 既存のファイルの内容は変更せず、ファイルが無い場合も作成しない。
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("出力ファイルにディレクトリが指定されています: %s", path)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("出力ファイルに書き込めません: %w", err)
+		}
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("出力ファイルに書き込めません: %w", err)
+	}
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("出力先のディレクトリがありません (--mkdir を指定すると作成します): %s", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("出力先がディレクトリではありません: %s", dir)
+	}
+	// ディレクトリに書き込めるかどうかは一時ファイルを作成して確認する
+	f, err := os.CreateTemp(dir, ".scrape-nikkei-past-price-*")
+	if err != nil {
+		return fmt.Errorf("出力先のディレクトリに書き込めません: %s", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// makeOutputDir は出力ファイル path のディレクトリが無い場合に作成する (--mkdir)。
+func makeOutputDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("出力先のディレクトリを作成できません: %w", err)
+	}
+	return nil
+}
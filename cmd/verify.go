@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "企業名とコードの対応表を日経のサイトで検索し直し、コードが変わった企業を出力します",
+	Long: `企業名とコードの対応表を日経のサイトで検索し直し、コードが変わった企業を出力します
+
+具体的な利用方法:
+  scrape-nikkei-past-price verify --input 企業コード一覧.csv --code-column 2 --output 差分.csv
+
+出力ファイルには、登録されているコードと検索し直したコードが異なる企業と、
+見つからなくなった企業 (上場廃止など) のみを書き出します。`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		var problems validationErrors
+
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			return err
+		}
+		if err := checkReadable(input); err != nil {
+			problems.add(err)
+		}
+		header, err := cmd.Flags().GetInt("header")
+		if err != nil {
+			return err
+		}
+		if header < 0 {
+			problems.addf("--header には 0 以上の値を指定してください: %d", header)
+		}
+		codeColumn, err := cmd.Flags().GetInt("code-column")
+		if err != nil {
+			return err
+		}
+		if codeColumn < 2 {
+			problems.addf("--code-column には 2 以上の列番号を指定してください: %d", codeColumn)
+		}
+		inputDelimiter, err := cmd.Flags().GetString("input-delimiter")
+		if err != nil {
+			return err
+		}
+		delimiter, err := parseDelimiter(inputDelimiter)
+		if err != nil {
+			problems.add(err)
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		mkdir, err := cmd.Flags().GetBool("mkdir")
+		if err != nil {
+			return err
+		}
+		if mkdir {
+			if err := makeOutputDir(output); err != nil {
+				problems.add(err)
+			}
+		}
+		if err := checkWritable(output); err != nil {
+			problems.add(err)
+		}
+		concurrency, err := cmd.Flags().GetInt64("concurrency")
+		if err != nil {
+			return err
+		}
+		if concurrency <= 0 {
+			problems.addf("--concurrency には 1 以上の値を指定してください: %d", concurrency)
+		}
+		if err := problems.err(); err != nil {
+			return err
+		}
+
+		src, err := openInputFile(cmd.Context(), input, "")
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(f)
+		defer func() {
+			w.Flush()
+			if flushErr := w.Error(); flushErr != nil && err == nil {
+				err = flushErr
+			}
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+		err = w.Write([]string{"企業名", "index", "登録されているコード", "取得したコード", "結果"})
+		if err != nil {
+			return err
+		}
+
+		var mu sync.Mutex
+		mismatches := 0
+		sem := semaphore.NewWeighted(concurrency)
+		scraper := NewScraper()
+		// readCsv の fallback にコードの列を読み込ませ、企業名で検索し直したコードと比べる
+		err = readCsv(bytes.NewReader(src), delimiter, 0, header, codeColumn-1, func(next rowIterator) error {
+			return dispatchRows(cmd.Context(), sem, next, nil, func(line int, companyName, storedCode string) error {
+				if companyName == "" {
+					return nil
+				}
+				code, err := scraper.LookupCode(cmd.Context(), companyName)
+				status := ""
+				switch {
+				case errors.Is(err, ErrCompanyNotFound):
+					status = "見つからない"
+				case err != nil:
+					logger.Printf("%d: %s の検索に失敗しました: %v", line, companyName, err)
+					status = "エラー: " + err.Error()
+				case code != normalizeStockCode(storedCode):
+					status = "変更"
+				default:
+					return nil
+				}
+				logger.Printf("%d: %s のコードが一致しません (登録: %s, 取得: %s)", line, companyName, storedCode, code)
+
+				mu.Lock()
+				defer mu.Unlock()
+				mismatches++
+				return w.Write([]string{companyName, strconv.Itoa(line), storedCode, code, status})
+			})
+		})
+		if err != nil {
+			return err
+		}
+		logger.Printf("コードが一致しない企業は %d 件でした", mismatches)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().String("input", "", "企業名とコードの列を含む csv ファイルのパスを指定してください (企業名は 1 列目)")
+	verifyCmd.MarkFlagFilename("input", "csv")
+	verifyCmd.MarkFlagRequired("input")
+
+	verifyCmd.Flags().Int("code-column", 2, "登録されているコードの列番号を 1 始まりで指定してください")
+	verifyCmd.Flags().Int("header", 1, "ヘッダとして読み飛ばす行数を指定してください (ヘッダが無い場合は 0)")
+	verifyCmd.Flags().String("input-delimiter", ",", "入力ファイルの区切り文字を指定してください (タブ区切りの場合は \\t)")
+
+	verifyCmd.Flags().String("output", "", "コードが一致しなかった企業を書き出す csv ファイルのパスを指定してください")
+	verifyCmd.MarkFlagRequired("output")
+	verifyCmd.Flags().Bool("mkdir", false, "出力ファイルのディレクトリが無い場合に作成します")
+
+	verifyCmd.Flags().Int64("concurrency", 5, "最大同時実行数を指定してください")
+}
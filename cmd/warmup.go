@@ -0,0 +1,48 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http/cookiejar"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// warmup は日経のサイトのトップページを 1 度取得し、そこで設定されたセッションの Cookie を
+// 以降のリクエストでも送るようにする (--warmup)。Client と NoRedirectClient は同じ Cookie を共有する。
+func (s *Scraper) warmup(ctx context.Context) error {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return err
+	}
+	s.Client.Jar = jar
+	s.NoRedirectClient.Jar = jar
+
+	rootURL := s.BaseURL + "/"
+	if err := s.checkRobots(rootURL); err != nil {
+		return err
+	}
+	defer s.waitMinDelay(ctx)
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := s.httpGet(reqCtx, s.Client, rootURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return statusError(resp)
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	if cookies := jar.Cookies(resp.Request.URL); len(cookies) > 0 {
+		s.logf("ウォームアップで %d 件の Cookie が設定されました", len(cookies))
+	} else {
+		s.logf("ウォームアップで Cookie は設定されませんでした")
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultSink は企業ごとの結果の出力先。--format の形式ごとに実装し、newResultSink で選ぶ。
+type ResultSink interface {
+	// WriteHeader は結果より前に書き込む内容 (CSV のヘッダ行や JSON の配列の始まりなど) を書き込む。
+	// 結果を書き込む前に 1 度だけ呼び出す
+	WriteHeader() error
+	// WriteResult は 1 企業分の結果を書き込む。index 列には result.Index を使う
+	WriteResult(result ScrapeResult) error
+	// Close は書き込んだ結果を確定してファイルを閉じる
+	Close() error
+}
+
+// flusher はバッファに溜まっている結果を途中でファイルに書き出せる ResultSink (--flush-every、--flush-interval)
+type flusher interface {
+	flush() error
+}
+
+// outputTarget は --output に指定された出力ファイルとその形式を表す。
+type outputTarget struct {
+	path   string
+	format string
+	gzip   bool
+}
+
+// formatByExtension は拡張子から推測する出力形式
+var formatByExtension = map[string]string{
+	".csv":     "csv",
+	".db":      "sqlite",
+	".sqlite":  "sqlite",
+	".sqlite3": "sqlite",
+	".ndjson":  "ndjson",
+	".jsonl":   "ndjson",
+	".json":    "json",
+	".xlsx":    "xlsx",
+}
+
+// parseOutputs は --output に指定されたパスごとに出力形式を決める。
+// 出力ファイルが 1 つで --format が明示されている場合はその形式を使う。それ以外の場合は拡張子から推測し、
+// 推測できない場合は --format の値を使う。拡張子が .gz の場合や gzipOutput が true の場合は gzip で圧縮する。
+func parseOutputs(paths []string, format string, formatChanged, gzipOutput bool) ([]outputTarget, error) {
+	targets := make([]outputTarget, len(paths))
+	seen := map[string]bool{}
+	for i, path := range paths {
+		if seen[path] {
+			return nil, fmt.Errorf("--output に同じファイルが複数回指定されています: %s", path)
+		}
+		seen[path] = true
+
+		target := outputTarget{path: path, format: format, gzip: gzipOutput || strings.HasSuffix(path, ".gz")}
+		if !(len(paths) == 1 && formatChanged) {
+			ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+			if f, ok := formatByExtension[ext]; ok {
+				target.format = f
+			}
+		}
+		switch target.format {
+		case "csv", "ndjson", "json":
+		case "sqlite", "xlsx":
+			if target.gzip {
+				return nil, fmt.Errorf("--format %s の場合は gzip で圧縮できません: %s", target.format, path)
+			}
+		default:
+			return nil, fmt.Errorf("対応していない出力形式です: %s", target.format)
+		}
+		targets[i] = target
+	}
+	return targets, nil
+}
+
+// newResultSink は target の形式に応じた ResultSink を作る。
+func newResultSink(target outputTarget, appendOutput bool, opts outputOptions) (ResultSink, error) {
+	switch target.format {
+	case "sqlite":
+		return newSqliteWriter(target.path)
+	case "ndjson":
+		return newNdjsonWriter(target.path, appendOutput, target.gzip)
+	case "json":
+		return newJSONWriter(target.path, target.gzip, opts.Pretty)
+	case "xlsx":
+		return newXlsxWriter(target.path, opts, opts.SheetBy), nil
+	default:
+		if opts.Transpose {
+			return newTransposeWriter(target.path, target.gzip, opts)
+		}
+		return newCsvWriter(target.path, appendOutput, target.gzip, opts)
+	}
+}
+
+// multiWriter は同じ結果を複数の出力ファイルに書き込む。
+type multiWriter []ResultSink
+
+func (m multiWriter) WriteHeader() error {
+	for _, sink := range m {
+		if err := sink.WriteHeader(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) WriteResult(result ScrapeResult) error {
+	for _, sink := range m {
+		if err := sink.WriteResult(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiWriter) flush() error {
+	for _, sink := range m {
+		if f, ok := sink.(flusher); ok {
+			if err := f.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close はすべての出力ファイルを閉じ、最初に発生したエラーを返す。
+func (m multiWriter) Close() error {
+	var firstErr error
+	for _, sink := range m {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// resultOutput は同じ結果を --output のすべての出力ファイルに書き込み、
+// 長時間の実行中でも途中までの結果がファイルに残るよう、一定の件数・時間ごとに書き出す。
+type resultOutput struct {
+	writers multiWriter
+	// 途中までの結果を書き出す件数と間隔 (--flush-every、--flush-interval)。0 の場合は書き出さない
+	flushEvery    int
+	flushInterval time.Duration
+	// 最後に出力ファイルへ書き出した時刻 (--flush-interval 用)
+	lastFlush time.Time
+	// 書き込んだ企業の件数
+	written int
+}
+
+// openOutputs は targets の出力ファイルをすべて作成してヘッダ行を書き込む。
+// 途中で失敗した場合は、それまでに作成した出力ファイルを閉じてからエラーを返す。
+func openOutputs(targets []outputTarget, appendOutput bool, opts outputOptions, flushEvery int, flushInterval time.Duration) (*resultOutput, error) {
+	o := &resultOutput{
+		writers:       make(multiWriter, 0, len(targets)),
+		flushEvery:    flushEvery,
+		flushInterval: flushInterval,
+		lastFlush:     time.Now(),
+	}
+	for _, target := range targets {
+		sink, err := newResultSink(target, appendOutput, opts)
+		if err != nil {
+			o.Close()
+			return nil, err
+		}
+		o.writers = append(o.writers, sink)
+	}
+	if err := o.writers.WriteHeader(); err != nil {
+		o.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// write は result をすべての出力ファイルに書き込み、flushEvery 件ごとか flushInterval ごとに書き出す。
+func (o *resultOutput) write(result ScrapeResult) error {
+	if err := o.writers.WriteResult(result); err != nil {
+		return err
+	}
+	o.written++
+	if (o.flushEvery > 0 && o.written%o.flushEvery == 0) || (o.flushInterval > 0 && time.Since(o.lastFlush) >= o.flushInterval) {
+		if err := o.writers.flush(); err != nil {
+			return err
+		}
+		o.lastFlush = time.Now()
+	}
+	return nil
+}
+
+// Close はすべての出力ファイルを閉じる。
+func (o *resultOutput) Close() error {
+	return o.writers.Close()
+}
+
+// errorFile は処理に失敗した企業を --error-output の CSV に書き出す。
+type errorFile struct {
+	f *os.File
+	w *csv.Writer
+	// 入力ファイルが複数ある場合に、入力ファイルの列も書き出すかどうか
+	withInputFile bool
+}
+
+// createErrorFile は path に --error-output のファイルを作成し、lang の言語でヘッダ行を書き込む。
+func createErrorFile(path, lang string, withInputFile bool) (*errorFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &errorFile{f: f, w: csv.NewWriter(f), withInputFile: withInputFile}
+	columns := []string{"企業名", "index", "エラー", "エラーの種類"}
+	if withInputFile {
+		columns = append(columns, "入力ファイル")
+	}
+	if err := e.w.Write(localizeColumns(lang, columns)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// write は inputFile の行で失敗した企業のエラーを 1 行書き込む。
+// パニックの場合は、どの企業のどの処理で発生したかを後から調べられるよう、エラー内容にスタックトレースも含める。
+func (e *errorFile) write(rowErr RowError, inputFile string) error {
+	message := rowErr.Err.Error()
+	var pe *panicError
+	if errors.As(rowErr.Err, &pe) && len(pe.stack) > 0 {
+		message += "\n" + pe.trimmedStack()
+	}
+	record := []string{rowErr.CompanyName, strconv.Itoa(rowErr.Index), message, errorKind(rowErr.Err)}
+	if e.withInputFile {
+		record = append(record, inputFile)
+	}
+	return e.w.Write(record)
+}
+
+// Close は書き込んだ内容を書き出してファイルを閉じる。
+func (e *errorFile) Close() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
+
+// csvWriter はスクレイピング結果を opts で指定された列の CSV として書き込む。
+type csvWriter struct {
+	out  io.WriteCloser
+	w    recordWriter
+	opts outputOptions
+	// 追記する既存のファイル (新しく作成した場合は空)。ヘッダ行を書き込まずに列が揃っているかを確認する
+	appendPath string
+	gzip       bool
+}
+
+// recordWriter は CSV の 1 行を書き込む。*csv.Writer と quotedCSVWriter が満たす。
+type recordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+func newCsvWriter(path string, appendOutput, gzipOutput bool, opts outputOptions) (*csvWriter, error) {
+	out, writeHeader, err := createOutputWriter(path, appendOutput, gzipOutput)
+	if err != nil {
+		return nil, err
+	}
+	var w recordWriter = csv.NewWriter(out)
+	if opts.AlwaysQuote {
+		w = newQuotedCSVWriter(out)
+	}
+	c := &csvWriter{out: out, w: w, opts: opts, gzip: gzipOutput}
+	if !writeHeader {
+		c.appendPath = path
+	}
+	return c, nil
+}
+
+// WriteHeader はヘッダ行を書き込む。既存のファイルに追記する場合は書き込まず、
+// 既存のファイルと列が揃っているかをヘッダ行で確認する。
+func (c *csvWriter) WriteHeader() error {
+	switch {
+	case c.opts.WithoutHeader:
+		return nil
+	case c.appendPath != "":
+		return checkExistingHeader(c.appendPath, c.gzip, c.opts.header())
+	default:
+		return c.w.Write(c.opts.header())
+	}
+}
+
+// checkExistingHeader は追記先の既存のファイルの 1 行目が header と一致するかを確認する。
+func checkExistingHeader(path string, gzipOutput bool, header []string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipOutput {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("追記先のファイルを gzip として読み込めません: %s: %w", path, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	existing, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("追記先のファイルのヘッダ行を読み込めません: %s: %w", path, err)
+	}
+	if strings.Join(existing, ",") != strings.Join(header, ",") {
+		return fmt.Errorf("追記先のファイルのヘッダ行が今回出力する列と一致しません (--columns などの指定を確認してください): %s\n  既存: %s\n  今回: %s", path, strings.Join(existing, ","), strings.Join(header, ","))
+	}
+	return nil
+}
+
+func (c *csvWriter) WriteResult(result ScrapeResult) error {
+	for _, record := range c.opts.records(result.Index, result) {
+		if err := c.w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return flushOutput(c.out)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		c.out.Close()
+		return err
+	}
+	return c.out.Close()
+}
+
+// quotedCSVWriter は数値や空欄も含め、すべての値をダブルクォートで囲んで書き込む (--always-quote)。
+// encoding/csv の Writer は必要な場合にしか囲まないため、囲み方が混在すると読み込めないツール向けに使う。
+type quotedCSVWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newQuotedCSVWriter(w io.Writer) *quotedCSVWriter {
+	return &quotedCSVWriter{w: bufio.NewWriter(w)}
+}
+
+func (q *quotedCSVWriter) Write(record []string) error {
+	if q.err != nil {
+		return q.err
+	}
+	for i, field := range record {
+		if i > 0 {
+			q.w.WriteByte(',')
+		}
+		q.w.WriteByte('"')
+		q.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		q.w.WriteByte('"')
+	}
+	_, q.err = q.w.WriteString("\n")
+	return q.err
+}
+
+func (q *quotedCSVWriter) Flush() {
+	if err := q.w.Flush(); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+func (q *quotedCSVWriter) Error() error {
+	return q.err
+}
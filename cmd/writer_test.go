@@ -0,0 +1,230 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// sinkTestResult は出力先のテストで書き込む 1 企業分の結果
+var sinkTestResult = ScrapeResult{
+	CompanyName: "トヨタ自動車",
+	StockCode:   "7203",
+	Index:       3,
+	Prices:      map[int]float64{2021: 2116, 2022: 1768},
+}
+
+// writeSink は target の ResultSink にヘッダと sinkTestResult を書き込んで閉じる。
+func writeSink(t *testing.T, target outputTarget) {
+	t.Helper()
+	sink, err := newResultSink(target, false, outputOptions{})
+	if err != nil {
+		t.Fatalf("newResultSink(%s) error = %v", target.format, err)
+	}
+	if err := sink.WriteHeader(); err != nil {
+		t.Fatalf("WriteHeader() error = %v", err)
+	}
+	if err := sink.WriteResult(sinkTestResult); err != nil {
+		t.Fatalf("WriteResult() error = %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestCsvSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	writeSink(t, outputTarget{path: path, format: "csv"})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want header and 1 row: %q", len(lines), b)
+	}
+	if !strings.HasPrefix(lines[0], "企業名,index,コード,2013") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "トヨタ自動車,3,7203,") {
+		t.Errorf("row = %q", lines[1])
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	writeSink(t, outputTarget{path: path, format: "json"})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []ndjsonRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		t.Fatalf("output is not a JSON array: %v: %s", err, b)
+	}
+	if len(records) != 1 || records[0].Index != 3 || records[0].StockCode != "7203" || records[0].Prices[2022] != 1768 {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestNdjsonSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	writeSink(t, outputTarget{path: path, format: "ndjson"})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), b)
+	}
+	var record ndjsonRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Index != 3 || record.CompanyName != "トヨタ自動車" || record.StockCode != "7203" {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestSqliteSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.db")
+	writeSink(t, outputTarget{path: path, format: "sqlite"})
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var (
+		idx  int
+		code string
+	)
+	if err := db.QueryRow("SELECT idx, code FROM companies WHERE name = ?", "トヨタ自動車").Scan(&idx, &code); err != nil {
+		t.Fatalf("companies: %v", err)
+	}
+	if idx != 3 || code != "7203" {
+		t.Errorf("companies = (%d, %q), want (3, 7203)", idx, code)
+	}
+	var prices int
+	if err := db.QueryRow("SELECT COUNT(*) FROM prices WHERE code = ?", "7203").Scan(&prices); err != nil {
+		t.Fatalf("prices: %v", err)
+	}
+	if prices != 2 {
+		t.Errorf("prices has %d rows, want 2", prices)
+	}
+}
+
+func TestXlsxSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	writeSink(t, outputTarget{path: path, format: "xlsx"})
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows(xlsxDefaultSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want header and 1 row: %q", len(rows), rows)
+	}
+	if rows[0][0] != "企業名" || rows[1][0] != "トヨタ自動車" || rows[1][1] != "3" || rows[1][2] != "7203" {
+		t.Errorf("rows = %q", rows)
+	}
+}
+
+func TestOpenOutputsFlushEvery(t *testing.T) {
+	dir := t.TempDir()
+	csvPath, ndjsonPath := filepath.Join(dir, "out.csv"), filepath.Join(dir, "out.ndjson")
+	output, err := openOutputs([]outputTarget{{path: csvPath, format: "csv"}, {path: ndjsonPath, format: "ndjson"}}, false, outputOptions{}, 1, 0)
+	if err != nil {
+		t.Fatalf("openOutputs() error = %v", err)
+	}
+	defer output.Close()
+	if err := output.write(sinkTestResult); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	// --flush-every 1 の場合は閉じる前でも書き込んだ結果がすべての出力ファイルに残る
+	for _, path := range []string{csvPath, ndjsonPath} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "7203") {
+			t.Errorf("%s before Close = %q, want the written result", filepath.Base(path), b)
+		}
+	}
+	if output.written != 1 {
+		t.Errorf("written = %d, want 1", output.written)
+	}
+}
+
+// panicSource は FetchPrices でパニックする PriceSource
+type panicSource struct{}
+
+func (panicSource) Name() string { return "panic" }
+
+func (panicSource) FetchPrices(ctx context.Context, companyName, fallback string) (ScrapeResult, error) {
+	var prices map[int]float64
+	prices[2022] = 0
+	return ScrapeResult{}, nil
+}
+
+// パニックした企業の行には、パニックした箇所からのスタックトレースも書き出す
+func TestErrorFilePanicStack(t *testing.T) {
+	_, rowErrs, err := Run(context.Background(), RunOptions{
+		Companies: []Company{{Name: "トヨタ自動車"}},
+		Source:    panicSource{},
+		Logger:    discardLogger{},
+	})
+	if err != nil || len(rowErrs) != 1 {
+		t.Fatalf("Run() error = %v, row errors = %v, want one row error", err, rowErrs)
+	}
+	path := filepath.Join(t.TempDir(), "errors.csv")
+	errorRows, err := createErrorFile(path, "ja", false)
+	if err != nil {
+		t.Fatalf("createErrorFile() error = %v", err)
+	}
+	if err := errorRows.write(rowErrs[0], ""); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	if err := errorRows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read %s error = %v", path, err)
+	}
+	if len(records) != 2 || records[1][0] != "トヨタ自動車" || records[1][3] != "panic" {
+		t.Fatalf("records = %q, want a panic row for トヨタ自動車", records)
+	}
+	message := records[1][2]
+	if !strings.HasPrefix(message, "panic: assignment to entry in nil map\n") {
+		t.Errorf("message = %q, want the panic value on the first line", message)
+	}
+	// スタックトレースはパニックした関数から始まり、recover 側のフレームは含まない
+	if !strings.Contains(message, "panicSource.FetchPrices") || strings.Contains(message, "debug.Stack") {
+		t.Errorf("message = %q, want the trimmed stack from panicSource.FetchPrices", message)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2022 YutaUra <yuuta3594@outlook.jp>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// xlsxDefaultSheet は --sheet-by を指定しない場合に結果を書き込むシート
+	xlsxDefaultSheet = "Sheet1"
+	// xlsxUngroupedSheet は --sheet-by の列の値が空の企業を書き込むシート
+	xlsxUngroupedSheet = "未分類"
+	// xlsxMaxSheetName は Excel のシート名の最大の文字数
+	xlsxMaxSheetName = 31
+)
+
+// xlsxNumericColumns は Excel で数値として扱えるよう、数値のセルとして書き込む列
+var xlsxNumericColumns = map[string]bool{
+	"index": true, "year": true, "close": true, "open": true, "volume": true, "dividend": true,
+	"nikkei225": true, "topix": true, "per": true, "pbr": true, "market_cap": true,
+	"current_price": true, "period_high": true, "period_low": true, "years_found": true, "split_adjusted": true, "quality_score": true,
+}
+
+// xlsxWriter はスクレイピング結果を Excel のブック (.xlsx) に書き込む。
+// sheetBy が指定されている場合は、その列の値ごとにシートを分ける (--sheet-by)。
+// ブックは Close でまとめて保存する。
+type xlsxWriter struct {
+	path    string
+	file    *excelize.File
+	opts    outputOptions
+	sheetBy string
+	// 数値のセルとして書き込むかどうか (出力する値の位置ごと)
+	numeric []bool
+	// シートごとの次に書き込む行 (1 始まり)
+	nextRow map[string]int
+}
+
+func newXlsxWriter(path string, opts outputOptions, sheetBy string) *xlsxWriter {
+	var numeric []bool
+	for _, column := range opts.columns() {
+		isNumeric := xlsxNumericColumns[column] || strings.HasPrefix(column, fieldColumnPrefix)
+		for range opts.field(column).headers(opts) {
+			numeric = append(numeric, isNumeric)
+		}
+	}
+	return &xlsxWriter{
+		path:    path,
+		file:    excelize.NewFile(),
+		opts:    opts,
+		sheetBy: sheetBy,
+		numeric: numeric,
+		nextRow: map[string]int{},
+	}
+}
+
+// validateSheetBy は --sheet-by に指定された列が、企業ごとに 1 つの値を持つ列かどうかを確認する。
+func validateSheetBy(column string, opts outputOptions) error {
+	field, ok := outputFields[column]
+	if !ok {
+		return fmt.Errorf("--sheet-by に不明な列 %q が指定されました (--columns と同じ列名を指定してください)", column)
+	}
+	if len(field.headers(opts)) != 1 || column == "year" || column == "month" {
+		return fmt.Errorf("--sheet-by には企業ごとに 1 つの値を持つ列 (market など) を指定してください: %s", column)
+	}
+	return nil
+}
+
+// sheetName は列の値 value を Excel のシート名として使える文字列に変換する。
+func sheetName(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return xlsxUngroupedSheet
+	}
+	// シート名に使えない文字は全角の記号に置き換える
+	value = strings.NewReplacer(":", "：", "\\", "＼", "/", "／", "?", "？", "*", "＊", "[", "［", "]", "］").Replace(value)
+	if runes := []rune(value); len(runes) > xlsxMaxSheetName {
+		value = string(runes[:xlsxMaxSheetName])
+	}
+	return value
+}
+
+// sheetFor は結果を書き込むシートを返す。初めて使うシートは作成してヘッダ行を書き込む。
+func (x *xlsxWriter) sheetFor(line int, result ScrapeResult) (string, error) {
+	sheet := xlsxDefaultSheet
+	if x.sheetBy != "" {
+		// 縦持ち形式などで複数行になる場合も、同じ企業の行は同じシートに書き込む
+		row := outputRow{Line: line, Result: result}
+		if rows := x.opts.rows(line, result); len(rows) > 0 {
+			row = rows[0]
+		}
+		sheet = sheetName(outputFields[x.sheetBy].values(x.opts, row)[0])
+	}
+	if _, ok := x.nextRow[sheet]; ok {
+		return sheet, nil
+	}
+	return sheet, x.startSheet(sheet)
+}
+
+// startSheet はシートを作成してヘッダ行を書き込む。
+func (x *xlsxWriter) startSheet(sheet string) error {
+	if sheet != xlsxDefaultSheet {
+		x.file.NewSheet(sheet)
+	}
+	x.nextRow[sheet] = 1
+	if x.opts.WithoutHeader {
+		return nil
+	}
+	return x.writeRow(sheet, x.opts.header(), false)
+}
+
+// WriteHeader は結果を書き込むシートにヘッダ行を書き込む。
+// --sheet-by の場合は書き込むシートが決まらないため、それぞれのシートに初めて書き込む際に書き込む。
+func (x *xlsxWriter) WriteHeader() error {
+	if x.sheetBy != "" {
+		return nil
+	}
+	return x.startSheet(xlsxDefaultSheet)
+}
+
+// writeRow は record をシートの次の行に書き込む。typed の場合は数値の列を数値のセルにする。
+func (x *xlsxWriter) writeRow(sheet string, record []string, typed bool) error {
+	cells := make([]interface{}, len(record))
+	for i, value := range record {
+		cells[i] = value
+		if typed && i < len(x.numeric) && x.numeric[i] {
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				cells[i] = number
+			}
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.nextRow[sheet])
+	if err != nil {
+		return err
+	}
+	if err := x.file.SetSheetRow(sheet, cell, &cells); err != nil {
+		return err
+	}
+	x.nextRow[sheet]++
+	return nil
+}
+
+func (x *xlsxWriter) WriteResult(result ScrapeResult) error {
+	sheet, err := x.sheetFor(result.Index, result)
+	if err != nil {
+		return err
+	}
+	for _, record := range x.opts.records(result.Index, result) {
+		if err := x.writeRow(sheet, record, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush は何もしない。xlsx はファイル全体を 1 度に書き出す形式のため、Close でまとめて保存する。
+func (x *xlsxWriter) flush() error {
+	return nil
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if len(x.nextRow) == 0 {
+		// --sheet-by で 1 件も書き込まなかった場合もヘッダ行だけのシートを残す
+		if err := x.startSheet(xlsxDefaultSheet); err != nil {
+			return err
+		}
+	} else if _, ok := x.nextRow[xlsxDefaultSheet]; !ok {
+		// --sheet-by で分けたシートだけを残す
+		x.file.DeleteSheet(xlsxDefaultSheet)
+		x.file.SetActiveSheet(0)
+	}
+	return x.file.SaveAs(x.path)
+}
@@ -4,8 +4,14 @@ Copyright © 2022 NAME HERE <EMAIL ADDRESS>
 */
 package main
 
-import "github.com/YutaUra/scrape-nikkei-past-price/cmd"
+import (
+	"os"
+
+	"github.com/YutaUra/scrape-nikkei-past-price/cmd"
+)
 
 func main() {
-	cmd.Execute()
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }